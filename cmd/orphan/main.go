@@ -5,15 +5,25 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/verify"
 	log "github.com/sirupsen/logrus"
 
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/monitor"
 	"slsa-verde/internal/orphan"
 	"slsa-verde/internal/orphan/config"
+	"slsa-verde/internal/v13s"
+)
+
+const (
+	defaultMaxDeletionPercentage = 20
+	defaultRekorURL              = "https://rekor.sigstore.dev"
 )
 
 func main() {
@@ -28,11 +38,40 @@ func main() {
 	dprackTeam := os.Getenv("DEPENDENCYTRACK_TEAM")
 	cluster := os.Getenv("CLUSTER")
 	logLevel := os.Getenv("LOG_LEVEL")
+	reportFile := os.Getenv("REPORT_FILE")
+	vulnerabilitiesApiUrl := os.Getenv("VULNERABILITIES_API_URL")
+	serviceAccountEmail := os.Getenv("SERVICE_ACCOUNT_EMAIL")
 	dryRun, err := strconv.ParseBool(os.Getenv("DRY_RUN"))
 	if err != nil {
 		log.Errorf("Error parsing DRY_RUN: %v", err)
 		return
 	}
+	budget, err := deletionBudget()
+	if err != nil {
+		log.Errorf("Error parsing deletion budget: %v", err)
+		return
+	}
+	retention, err := versionRetention()
+	if err != nil {
+		log.Errorf("Error parsing retention: %v", err)
+		return
+	}
+	var scaledDownGracePeriod time.Duration
+	if v := os.Getenv("SCALED_DOWN_GRACE_PERIOD"); v != "" {
+		scaledDownGracePeriod, err = time.ParseDuration(v)
+		if err != nil {
+			log.Errorf("Error parsing SCALED_DOWN_GRACE_PERIOD: %v", err)
+			return
+		}
+	}
+	backfill := false
+	if v := os.Getenv("BACKFILL"); v != "" {
+		backfill, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Errorf("Error parsing BACKFILL: %v", err)
+			return
+		}
+	}
 
 	err = setupLogger(logLevel)
 	if err != nil {
@@ -41,6 +80,9 @@ func main() {
 	}
 
 	log.Infoln("DRY_RUN:", dryRun)
+	if dryRun && scaledDownGracePeriod > 0 {
+		log.Warnf("dry run, the projects of workloads scaled down for more than %s are not removed", scaledDownGracePeriod)
+	}
 	kconfig, err := config.ClusterConfig(log.WithField("system", "cluster-config"))
 	if err != nil {
 		log.Errorf("Error getting cluster config: %v", err)
@@ -85,10 +127,111 @@ func main() {
 
 	ctx := context.Background()
 	o := orphan.New(ctx, dpClient, ctrlClient, cluster, log.WithField("system", "orphan-projects"))
-	if err = o.Run(dryRun); err != nil {
+	o.Budget = budget
+	o.Retention = retention
+	o.ScaledDownGracePeriod = scaledDownGracePeriod
+	if vulnerabilitiesApiUrl != "" {
+		vulnzClient, err := v13s.NewClient(ctx, vulnerabilitiesApiUrl, serviceAccountEmail)
+		if err != nil {
+			log.Errorf("Error creating vulnerabilities client: %v", err)
+			return
+		}
+		defer vulnzClient.Close()
+		o.VulnerabilitiesClient = vulnzClient
+	}
+	if backfill {
+		o.Verifier, err = verifier()
+		if err != nil {
+			log.Errorf("Error creating attestation verifier: %v", err)
+			return
+		}
+	}
+	report, err := o.Run(dryRun)
+	if werr := writeReport(report, reportFile); werr != nil {
+		log.Errorf("Error writing report: %v", werr)
+	}
+	if err != nil {
 		log.Errorf("Error running orphan projects: %v", err)
-		return
+		os.Exit(1)
+	}
+}
+
+// deletionBudget reads MAX_DELETIONS and MAX_DELETION_PERCENTAGE, 0 disables a limit
+func deletionBudget() (orphan.Budget, error) {
+	budget := orphan.Budget{
+		MaxDeletionPercentage: defaultMaxDeletionPercentage,
+	}
+	if v := os.Getenv("MAX_DELETIONS"); v != "" {
+		maxDeletions, err := strconv.Atoi(v)
+		if err != nil {
+			return budget, fmt.Errorf("parsing MAX_DELETIONS: %w", err)
+		}
+		budget.MaxDeletions = maxDeletions
+	}
+	if v := os.Getenv("MAX_DELETION_PERCENTAGE"); v != "" {
+		percentage, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return budget, fmt.Errorf("parsing MAX_DELETION_PERCENTAGE: %w", err)
+		}
+		budget.MaxDeletionPercentage = percentage
+	}
+	return budget, nil
+}
+
+// versionRetention reads RETENTION_VERSIONS and RETENTION_MAX_AGE, superseded projects beyond it are pruned
+func versionRetention() (monitor.Retention, error) {
+	var r monitor.Retention
+	if v := os.Getenv("RETENTION_VERSIONS"); v != "" {
+		versions, err := strconv.Atoi(v)
+		if err != nil {
+			return r, fmt.Errorf("parsing RETENTION_VERSIONS: %w", err)
+		}
+		r.Versions = versions
+	}
+	if v := os.Getenv("RETENTION_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil {
+			return r, fmt.Errorf("parsing RETENTION_MAX_AGE: %w", err)
+		}
+		r.MaxAge = maxAge
+	}
+	return r, nil
+}
+
+// verifier verifies attestations like slsa-verde, configured by GITHUB_ORGANIZATIONS, COSIGN_KEY_REF and COSIGN_REKOR_URL
+func verifier() (attestation.Verifier, error) {
+	rekorURL := os.Getenv("COSIGN_REKOR_URL")
+	if rekorURL == "" {
+		rekorURL = defaultRekorURL
+	}
+	var organizations []string
+	if v := os.Getenv("GITHUB_ORGANIZATIONS"); v != "" {
+		organizations = strings.Split(v, ",")
+	}
+	return attestation.NewVerifyAttestationOpts(
+		&verify.VerifyAttestationCommand{RekorURL: rekorURL},
+		organizations,
+		os.Getenv("COSIGN_KEY_REF"),
+	)
+}
+
+// writeReport writes the report as JSON to file, or stdout if file is empty
+func writeReport(report *orphan.Report, file string) error {
+	if report == nil {
+		return nil
+	}
+	if file == "" {
+		return report.Write(os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f); err != nil {
+		_ = f.Close()
+		return err
 	}
+	return f.Close()
 }
 
 func setupLogger(loglevel string) error {
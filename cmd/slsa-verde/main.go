@@ -2,23 +2,18 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"google.golang.org/grpc/credentials/insecure"
-
-	"google.golang.org/grpc/credentials"
-
-	"github.com/nais/v13s/pkg/api/auth"
 	"github.com/nais/v13s/pkg/api/vulnerabilities"
-	"google.golang.org/grpc"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -26,23 +21,44 @@ import (
 	flag "github.com/spf13/pflag"
 
 	_ "net/http/pprof"
+	"slsa-verde/internal/api"
 	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/health"
 	"slsa-verde/internal/monitor"
+	"slsa-verde/internal/notification"
+	"slsa-verde/internal/observability"
+	"slsa-verde/internal/orphan"
+	"slsa-verde/internal/outbox"
+	"slsa-verde/internal/policyreport"
+	"slsa-verde/internal/portfolio"
+	"slsa-verde/internal/projectindex"
+	"slsa-verde/internal/provenance"
+	"slsa-verde/internal/sbomstore"
+	"slsa-verde/internal/state"
+	"slsa-verde/internal/v13s"
 
 	"github.com/nais/dependencytrack/pkg/client"
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/verify"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 type Cosign struct {
@@ -63,6 +79,29 @@ type DependencyTrack struct {
 	Team     string `json:"team"`
 }
 
+type Orphan struct {
+	Interval              time.Duration `json:"interval"`
+	DryRun                bool          `json:"dry-run"`
+	MaxDeletions          int           `json:"max-deletions"`
+	MaxDeletionPercentage float64       `json:"max-deletion-percentage"`
+	Backfill              bool          `json:"backfill"`
+}
+
+type PortfolioAccess struct {
+	Enabled bool              `json:"enabled"`
+	Teams   map[string]string `json:"teams"`
+}
+
+type Retention struct {
+	Versions int           `json:"versions"`
+	MaxAge   time.Duration `json:"max-age"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int           `json:"failure-threshold"`
+	Cooldown         time.Duration `json:"cooldown"`
+}
+
 type Config struct {
 	Cluster               string          `json:"cluster"`
 	Cosign                Cosign          `json:"cosign"`
@@ -75,10 +114,32 @@ type Config struct {
 	InformerReListHours   int             `json:"informer-re-list-hours"`
 	VulnerabilitiesApiUrl string          `json:"vulnerabilities-api-url"`
 	ServiceAccountEmail   string          `json:"service-account-email"`
+	OtelExporterEndpoint  string          `json:"otel-exporter-otlp-endpoint"`
+	WorkloadAnnotations   bool            `json:"workload-annotations"`
+	PolicyReports         bool            `json:"policy-reports"`
+	NotificationsConfig   string          `json:"notifications-config"`
+	Orphan                Orphan          `json:"orphan"`
+	OutboxDir             string          `json:"outbox-dir"`
+	CircuitBreaker        CircuitBreaker  `json:"circuit-breaker"`
+	Retention             Retention       `json:"retention"`
+	TrackRollouts         bool            `json:"track-rollouts"`
+	ScaledDownGracePeriod time.Duration   `json:"scaled-down-grace-period"`
+	ProjectHierarchy      bool            `json:"project-hierarchy"`
+	PortfolioAccess       PortfolioAccess `json:"portfolio-access"`
+	ProvenanceProperties  bool            `json:"provenance-properties"`
+	ProjectIndexInterval  time.Duration   `json:"project-index-interval"`
+	LivenessEventTimeout  time.Duration   `json:"liveness-event-timeout"`
 }
 
 type SlsaInformers map[string]cache.SharedIndexInformer
 
+// currentInformers are the informers of the current re-list interval, set once their caches are synced
+var currentInformers atomic.Pointer[SlsaInformers]
+
+// naisjobsErr is the error listing the naisjobs when the current informers were set up, nil if the naisjobs are
+// watched or their custom resource does not exist
+var naisjobsErr atomic.Pointer[error]
+
 var cfg = &Config{
 	LogLevel: "debug",
 }
@@ -101,6 +162,28 @@ func init() {
 	flag.IntVar(&cfg.InformerReListHours, "informer-re-list-hours", 6, "Interval for re-listing of resources in hours")
 	flag.StringVar(&cfg.VulnerabilitiesApiUrl, "vulnerabilities-api-url", "", "Vulnerabilities API URL")
 	flag.StringVar(&cfg.ServiceAccountEmail, "service-account-email", "", "Service account email")
+	flag.StringVar(&cfg.OtelExporterEndpoint, "otel-exporter-otlp-endpoint", "", "OTLP endpoint to export traces to, tracing is disabled if empty")
+	flag.StringVar(&cfg.NotificationsConfig, "notifications-config", "", "Path to the notification routes config, notifications are disabled if empty")
+	flag.BoolVar(&cfg.PolicyReports, "policy-reports", false, "Publish the verification status of workloads as PolicyReports")
+	flag.BoolVar(&cfg.WorkloadAnnotations, "workload-annotations", false, "Annotate workloads with the verification status of their containers")
+	flag.StringVar(&cfg.OutboxDir, "outbox-dir", "", "Directory of the outbox of writes to Dependency-Track and v13s failing while they are unavailable, disabled if empty")
+	flag.BoolVar(&cfg.TrackRollouts, "track-rollouts", true, "Tag the images of all ReplicaSets of a Deployment with ready pods to it during a rollout")
+	flag.BoolVar(&cfg.ProjectHierarchy, "project-hierarchy", false, "Create the projects of new versions under parent projects per team and application")
+	flag.BoolVar(&cfg.PortfolioAccess.Enabled, "portfolio-access", false, "Grant a Dependency-Track team per namespace access to the projects of its workloads, creating the teams")
+	flag.StringToStringVar(&cfg.PortfolioAccess.Teams, "portfolio-access-teams", map[string]string{}, "Teams of namespaces not named after them, e.g. namespace=team")
+	flag.BoolVar(&cfg.ProvenanceProperties, "provenance-properties", false, "Record the provenance of images as Dependency-Track project properties instead of tags")
+	flag.DurationVar(&cfg.ProjectIndexInterval, "project-index-interval", 0, "Interval of the refresh of the index of the projects of the cluster answering project lookups instead of Dependency-Track, disabled if 0")
+	flag.DurationVar(&cfg.LivenessEventTimeout, "liveness-event-timeout", 30*time.Minute, "Fail the liveness probe once handling an informer event takes longer than this")
+	flag.DurationVar(&cfg.ScaledDownGracePeriod, "scaled-down-grace-period", 0, "Keep the projects of workloads scaled down to zero replicas for this long, marked as scaled down, removed right away if 0")
+	flag.IntVar(&cfg.Retention.Versions, "retention-versions", 0, "Keep the projects of this many previous versions of a workload as superseded instead of deleting them")
+	flag.DurationVar(&cfg.Retention.MaxAge, "retention-max-age", 0, "Keep the projects of previous versions of a workload superseded within this duration instead of deleting them")
+	flag.IntVar(&cfg.CircuitBreaker.FailureThreshold, "circuit-breaker-failure-threshold", 5, "Consecutive failed calls to Dependency-Track, a registry or v13s before calls to it fail fast")
+	flag.DurationVar(&cfg.CircuitBreaker.Cooldown, "circuit-breaker-cooldown", 30*time.Second, "Time calls to an unavailable backend fail fast before one is let through again")
+	flag.DurationVar(&cfg.Orphan.Interval, "orphan-interval", 0, "Interval of the cleanup of projects of workloads that are gone, disabled if 0")
+	flag.BoolVar(&cfg.Orphan.DryRun, "orphan-dry-run", true, "Only report the actions of the cleanup of projects of workloads that are gone")
+	flag.IntVar(&cfg.Orphan.MaxDeletions, "orphan-max-deletions", 100, "Abort cleanup runs planning to delete more projects than this, 0 disables the limit")
+	flag.BoolVar(&cfg.Orphan.Backfill, "orphan-backfill", false, "Re-verify the images of projects missing attestation tags whose workloads still exist instead of deleting them")
+	flag.Float64Var(&cfg.Orphan.MaxDeletionPercentage, "orphan-max-deletion-percentage", 20, "Abort cleanup runs planning to delete a larger percentage of the projects, 0 disables the limit")
 }
 
 func main() {
@@ -144,6 +227,19 @@ func main() {
 }
 
 func run(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, mainLogger *log.Entry) error {
+	if cfg.OtelExporterEndpoint != "" {
+		mainLogger.Infof("exporting traces to %s", cfg.OtelExporterEndpoint)
+		shutdownTracing, err := observability.SetupTracing(ctx, cfg.OtelExporterEndpoint, "slsa-verde")
+		if err != nil {
+			return fmt.Errorf("setup tracing: %w", err)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				mainLogger.WithError(err).Warn("shutdown tracing")
+			}
+		}()
+	}
+
 	verifyCmd := &verify.VerifyAttestationCommand{
 		RekorURL:   cfg.Cosign.RekorURL,
 		LocalImage: cfg.Cosign.LocalImage,
@@ -159,6 +255,9 @@ func run(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dy
 		return fmt.Errorf("failed to create attestation options: %w", err)
 	}
 
+	breaker.Default.FailureThreshold = cfg.CircuitBreaker.FailureThreshold
+	breaker.Default.Cooldown = cfg.CircuitBreaker.Cooldown
+
 	mainLogger.Info("setting up dtrack client")
 	s := client.New(
 		cfg.DependencyTrack.Api,
@@ -191,8 +290,150 @@ func run(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dy
 		mainLogger.Info("No vulnerabilities API URL set, skipping vulnerabilities client setup")
 	}
 
-	m := monitor.NewMonitor(ctx, s, c, opts, cfg.Cluster)
-	if err = startInformers(ctx, m, k8sClient, dynamicClient, cfg.Namespace, mainLogger); err != nil {
+	broadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	defer broadcaster.Shutdown()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "slsa-verde"})
+
+	monitorOpts := []monitor.Option{monitor.WithEventRecorder(recorder)}
+	if cfg.WorkloadAnnotations {
+		monitorOpts = append(monitorOpts, monitor.WithWorkloadAnnotations(dynamicClient))
+	}
+
+	store := state.NewStore()
+	monitorOpts = append(monitorOpts, monitor.WithStore(store))
+	if cfg.PolicyReports {
+		_, err := dynamicClient.Resource(policyreport.GroupVersionResource).List(ctx, v1.ListOptions{Limit: 1})
+		if err != nil {
+			mainLogger.Info("could not list policyreports, skipping policy reports, " + err.Error())
+		} else {
+			// reports are synced off the informer handlers, once per interval for the namespaces with changes
+			reporter := policyreport.NewDebounced(policyreport.New(dynamicClient, store), 10*time.Second)
+			go reporter.Run(ctx)
+			monitorOpts = append(monitorOpts, monitor.WithPolicyReporter(reporter))
+		}
+	}
+
+	if cfg.NotificationsConfig != "" {
+		notificationsCfg, err := notification.LoadConfig(cfg.NotificationsConfig)
+		if err != nil {
+			return err
+		}
+		notifier, err := notification.New(notificationsCfg, "slsa-verde/"+cfg.Cluster)
+		if err != nil {
+			return fmt.Errorf("setup notifications: %w", err)
+		}
+		mainLogger.Infof("sending notifications to %d route(s)", len(notificationsCfg.Routes))
+		go notifier.Run(ctx)
+		monitorOpts = append(monitorOpts, monitor.WithNotifier(notifier))
+	}
+
+	var ob *outbox.Outbox
+	if cfg.OutboxDir != "" {
+		ob, err = outbox.New(cfg.OutboxDir)
+		if err != nil {
+			return fmt.Errorf("setup outbox: %w", err)
+		}
+		monitorOpts = append(monitorOpts, monitor.WithOutbox(ob))
+	} else {
+		mainLogger.Warn("no outbox directory, pending copies of audit decisions to new versions are kept in memory and lost on restart")
+	}
+
+	retention := monitor.Retention{Versions: cfg.Retention.Versions, MaxAge: cfg.Retention.MaxAge}
+	if retention.Enabled() {
+		mainLogger.Infof("keeping the projects of the last %d previous versions and the ones superseded within %s as inactive", retention.Versions, retention.MaxAge)
+		monitorOpts = append(monitorOpts, monitor.WithRetention(retention), monitor.WithProjectActivity(sbomstore.NewAPI(s, cfg.DependencyTrack.Api)))
+	}
+
+	if cfg.ScaledDownGracePeriod > 0 {
+		mainLogger.Infof("keeping the projects of scaled down workloads for %s", cfg.ScaledDownGracePeriod)
+		if cfg.Orphan.Interval == 0 || cfg.Orphan.DryRun {
+			// the projects are only removed by the orphan cleanup once the grace period has passed
+			mainLogger.Warnf("the projects of scaled down workloads are kept until removed by the orphan cleanup, they are never removed unless the orphan cronjob or the in-process cleanup runs without dry run")
+		}
+		monitorOpts = append(monitorOpts, monitor.WithScaledDownMarker())
+	}
+
+	if cfg.ProjectHierarchy {
+		mainLogger.Info("creating the projects of new versions under parent projects per team and application")
+		monitorOpts = append(monitorOpts, monitor.WithProjectHierarchy())
+	}
+
+	if cfg.PortfolioAccess.Enabled {
+		mainLogger.Info("granting the teams of namespaces access to the projects of their workloads")
+		monitorOpts = append(monitorOpts, monitor.WithPortfolioAccess(portfolio.New(s, cfg.DependencyTrack.Api, cfg.PortfolioAccess.Teams)))
+	}
+
+	if cfg.ProvenanceProperties {
+		mainLogger.Info("recording the provenance of images as project properties")
+		monitorOpts = append(monitorOpts, monitor.WithProvenanceProperties(provenance.New(s, cfg.DependencyTrack.Api)))
+	}
+
+	if cfg.ProjectIndexInterval > 0 {
+		mainLogger.Infof("answering project lookups from an index refreshed every %s", cfg.ProjectIndexInterval)
+		index := projectindex.New(s, cfg.Cluster)
+		go index.Run(ctx, cfg.ProjectIndexInterval)
+		monitorOpts = append(monitorOpts, monitor.WithProjectIndex(index))
+	}
+
+	m := monitor.NewMonitor(ctx, s, c, opts, cfg.Cluster, monitorOpts...)
+	if ob != nil {
+		mainLogger.Infof("deferring writes while Dependency-Track or v13s are unavailable to %s", cfg.OutboxDir)
+		go ob.Run(ctx)
+	}
+	http.Handle("/api/v1/", api.NewHandler(m.Store))
+
+	checker := health.NewChecker(5 * time.Second)
+	checker.Add("informers", informersSynced)
+	checker.Add("trust-material", func(context.Context) error {
+		return opts.CheckTrustMaterial()
+	})
+	checker.Add("dependencytrack", func(ctx context.Context) error {
+		_, err := m.Client.Version(ctx)
+		return err
+	})
+	if cfg.VulnerabilitiesApiUrl != "" {
+		checker.Add("vulnerabilities", health.DialCheck(cfg.VulnerabilitiesApiUrl))
+	}
+	// an unreachable registry only fails the verification of its images, not the readiness of slsa-verde
+	checker.Add("circuit-breakers", func(context.Context) error {
+		return breaker.Default.Check("dependencytrack", "v13s")
+	})
+	heartbeat := health.NewHeartbeat(cfg.LivenessEventTimeout)
+	checker.AddLiveness("informer-events", heartbeat.Check)
+	http.Handle("/healthz", checker.LivenessHandler())
+	http.Handle("/readyz", checker.ReadinessHandler())
+
+	if cfg.Orphan.Interval > 0 {
+		o := orphan.NewWithLister(ctx, m.Client, informerLister{}, cfg.Cluster, log.WithField("component", "orphan"))
+		o.Namespace = cfg.Namespace
+		o.Budget = orphan.Budget{
+			MaxDeletions:          cfg.Orphan.MaxDeletions,
+			MaxDeletionPercentage: cfg.Orphan.MaxDeletionPercentage,
+		}
+		o.Retention = retention
+		o.ScaledDownGracePeriod = cfg.ScaledDownGracePeriod
+		if cfg.Orphan.Backfill {
+			o.Verifier = opts
+		}
+		if c != nil {
+			o.VulnerabilitiesClient = c
+		}
+		collector := orphan.NewCollector(o, cfg.Orphan.Interval, cfg.Orphan.DryRun)
+		http.Handle("/api/v1/orphan", collector)
+		mainLogger.Infof("cleaning up projects of workloads that are gone every %s, dry run: %v", cfg.Orphan.Interval, cfg.Orphan.DryRun)
+		go func() {
+			// the first cleanup runs once the informer caches are synced, the workloads are listed from them
+			if err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+				return informersSynced(ctx) == nil, nil
+			}); err != nil {
+				return
+			}
+			collector.Run(ctx)
+		}()
+	}
+
+	if err = startInformers(ctx, m, heartbeat, k8sClient, dynamicClient, cfg.Namespace, mainLogger); err != nil {
 		return fmt.Errorf("start informers: %w", err)
 	}
 
@@ -212,32 +453,12 @@ func run(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dy
 
 func vulnerabilitiesClient(ctx context.Context, mainLogger *log.Entry) (vulnerabilities.Client, error) {
 	mainLogger.Infof("Using vulnerabilities API on url: %s", cfg.VulnerabilitiesApiUrl)
-	dialOptions := make([]grpc.DialOption, 0)
-	if strings.Contains(cfg.VulnerabilitiesApiUrl, "localhost") {
-		dialOptions = append(dialOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	} else {
-		tlsOpts := &tls.Config{}
-		transportCreds := credentials.NewTLS(tlsOpts)
-		dialOptions = append(dialOptions, grpc.WithTransportCredentials(transportCreds))
-	}
-
-	creds, err := auth.PerRPCGoogleIDToken(ctx, cfg.ServiceAccountEmail, "v13s")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get per rpc google id token: %w", err)
-	}
-	dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(creds))
-
-	c, err := vulnerabilities.NewClient(
-		cfg.VulnerabilitiesApiUrl,
-		dialOptions...,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create vulnerabilities client: %w", err)
-	}
-	return c, err
+	return v13s.NewClient(ctx, cfg.VulnerabilitiesApiUrl, cfg.ServiceAccountEmail)
 }
 
-func prepareInformers(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, namespace string, logger *log.Entry) SlsaInformers {
+// prepareInformers sets up the informers of the workloads, it returns the error listing the naisjobs if they exist
+// but can not be watched, e.g. as access is denied, the other informers are set up nonetheless
+func prepareInformers(ctx context.Context, k8sClient *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, namespace string, logger *log.Entry) (SlsaInformers, error) {
 	logger.Info("prepare informer(s)")
 	// default ignore system namespaces
 	switch namespace {
@@ -265,15 +486,22 @@ func prepareInformers(ctx context.Context, k8sClient *kubernetes.Clientset, dyna
 	infs := SlsaInformers{
 		"deployment": factory.Apps().V1().Deployments().Informer(),
 	}
+	if cfg.TrackRollouts {
+		infs["replicaset"] = factory.Apps().V1().ReplicaSets().Informer()
+	}
 
 	_, err := dynamicClient.Resource(nais_io_v1.GroupVersion.WithResource("naisjobs")).List(ctx, v1.ListOptions{})
-	if err != nil {
-		logger.Info("could not list naisjobs, skipping informer setup for naisjobs, " + err.Error())
-	} else {
+	switch {
+	case err == nil:
 		infs["naisjobs"] = dinf.ForResource(nais_io_v1.GroupVersion.WithResource("naisjobs")).Informer()
+	case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+		logger.Info("naisjob custom resource definition not found, skipping informer setup for naisjobs")
+	default:
+		logger.Warnf("could not list naisjobs, skipping informer setup for naisjobs until the next re-list: %v", err)
+		return infs, err
 	}
 
-	return infs
+	return infs, nil
 }
 
 func setupKubeConfig() *rest.Config {
@@ -296,7 +524,7 @@ func setupKubeConfig() *rest.Config {
 	return kubeConfig
 }
 
-func startInformers(ctx context.Context, monitor *monitor.Config, k8sClient *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, namespace string, log *log.Entry) error {
+func startInformers(ctx context.Context, monitor *monitor.Config, heartbeat *health.Heartbeat, k8sClient *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, namespace string, log *log.Entry) error {
 	log.Infof("setting up informer(s) with %d-hours interval for re-listing of resources", cfg.InformerReListHours)
 
 	ticker := time.NewTicker(time.Duration(cfg.InformerReListHours) * time.Hour)
@@ -307,16 +535,25 @@ func startInformers(ctx context.Context, monitor *monitor.Config, k8sClient *kub
 		informerCtx, cancel := context.WithCancel(ctx)
 
 		// Recreate the informer factory and set up the informers
-		slsaInformers := prepareInformers(informerCtx, k8sClient, dynamicClient, namespace, log)
-		for name, informer := range slsaInformers {
+		slsaInformers, jobsErr := prepareInformers(informerCtx, k8sClient, dynamicClient, namespace, log)
+		for _, name := range informerOrder(slsaInformers) {
+			informer := slsaInformers[name]
 			l := log.WithField("resource", name)
 
 			l.Info("setting up monitor for resource")
-			_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			handler := cache.ResourceEventHandlerFuncs{
 				AddFunc:    monitor.OnAdd,
 				UpdateFunc: monitor.OnUpdate,
 				DeleteFunc: monitor.OnDelete,
-			})
+			}
+			if name == "replicaset" {
+				handler = cache.ResourceEventHandlerFuncs{
+					AddFunc:    monitor.OnReplicaSetAdd,
+					UpdateFunc: monitor.OnReplicaSetUpdate,
+					DeleteFunc: monitor.OnReplicaSetDelete,
+				}
+			}
+			_, err := informer.AddEventHandler(withHeartbeat(heartbeat, handler))
 			if err != nil {
 				cancel()
 				return fmt.Errorf("add event handler: %w", err)
@@ -331,6 +568,12 @@ func startInformers(ctx context.Context, monitor *monitor.Config, k8sClient *kub
 
 			l.Infof("informer cache synced: %v", informer.HasSynced())
 		}
+		if jobsErr != nil {
+			naisjobsErr.Store(&jobsErr)
+		} else {
+			naisjobsErr.Store(nil)
+		}
+		currentInformers.Store(&slsaInformers)
 
 		// Wait for ticker or context cancellation
 		select {
@@ -344,6 +587,79 @@ func startInformers(ctx context.Context, monitor *monitor.Config, k8sClient *kub
 	}
 }
 
+// informerOrder returns the names of the informers in the order to start them in, the replicaset informer first:
+// the handlers of the deployments need the ReplicaSets of a rollout, so its cache is synced before they run
+func informerOrder(informers SlsaInformers) []string {
+	names := make([]string, 0, len(informers))
+	for name := range informers {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		switch {
+		case a == "replicaset":
+			return -1
+		case b == "replicaset":
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+	return names
+}
+
+// withHeartbeat records the events handled by handler on heartbeat, a handler stuck on an event fails the liveness probe
+func withHeartbeat(heartbeat *health.Heartbeat, handler cache.ResourceEventHandlerFuncs) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			defer heartbeat.Begin()()
+			handler.AddFunc(obj)
+		},
+		UpdateFunc: func(old, new any) {
+			defer heartbeat.Begin()()
+			handler.UpdateFunc(old, new)
+		},
+		DeleteFunc: func(obj any) {
+			defer heartbeat.Begin()()
+			handler.DeleteFunc(obj)
+		},
+	}
+}
+
+func informersSynced(context.Context) error {
+	informers := currentInformers.Load()
+	if informers == nil {
+		return fmt.Errorf("informer caches not synced")
+	}
+	for name, informer := range *informers {
+		if !informer.HasSynced() {
+			return fmt.Errorf("informer cache for %s not synced", name)
+		}
+	}
+	return nil
+}
+
+// informerLister lists the workloads in the informer caches
+type informerLister struct{}
+
+func (informerLister) ListWorkloads(ctx context.Context) ([]*monitor.Workload, error) {
+	if err := informersSynced(ctx); err != nil {
+		return nil, err
+	}
+	// without the naisjobs every project of a naisjob would look orphaned
+	if err := naisjobsErr.Load(); err != nil {
+		return nil, fmt.Errorf("error listing jobs: %w", *err)
+	}
+	workloads := make([]*monitor.Workload, 0)
+	for _, informer := range *currentInformers.Load() {
+		for _, obj := range informer.GetStore().List() {
+			if w := monitor.NewWorkload(obj); w != nil {
+				workloads = append(workloads, w)
+			}
+		}
+	}
+	return workloads, nil
+}
+
 func setupConfig() error {
 	log.Info("-------- setting up configuration -----------")
 	err := Load()
@@ -355,6 +671,8 @@ func setupConfig() error {
 }
 
 func setupLogger() error {
+	log.AddHook(&observability.TraceHook{})
+
 	if cfg.DevelopmentMode {
 		log.SetLevel(log.DebugLevel)
 		formatter := &log.TextFormatter{
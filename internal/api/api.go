@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/state"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns a read-only JSON API over the verification state of the workloads.
+func NewHandler(store *state.Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/workloads", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, store.List(r.URL.Query().Get("namespace")))
+	})
+	mux.HandleFunc("GET /api/v1/workloads/{namespace}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, store.List(r.PathValue("namespace")))
+	})
+	mux.HandleFunc("GET /api/v1/workloads/{namespace}/{type}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		workload, ok := store.Get(r.PathValue("namespace"), r.PathValue("type"), r.PathValue("name"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "workload not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, workload)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithField("package", "api").Warnf("write response: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+)
+
+func TestHandler(t *testing.T) {
+	store := state.NewStore()
+	store.SetContainer("ns1", "app1", "app", state.Container{Name: "app1", Status: attestation.StatusVerified, ProjectUuid: "uuid1"})
+	store.SetContainer("ns2", "app2", "app", state.Container{Name: "app2", Status: attestation.StatusUnsigned, Error: "no matching attestations"})
+	handler := NewHandler(store)
+
+	for _, tt := range []struct {
+		name      string
+		path      string
+		status    int
+		workloads []string
+	}{
+		{name: "list all workloads", path: "/api/v1/workloads", status: http.StatusOK, workloads: []string{"app1", "app2"}},
+		{name: "list workloads by query", path: "/api/v1/workloads?namespace=ns2", status: http.StatusOK, workloads: []string{"app2"}},
+		{name: "list workloads in namespace", path: "/api/v1/workloads/ns1", status: http.StatusOK, workloads: []string{"app1"}},
+		{name: "list workloads in empty namespace", path: "/api/v1/workloads/ns3", status: http.StatusOK, workloads: []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var workloads []state.Workload
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &workloads))
+			names := make([]string, 0)
+			for _, w := range workloads {
+				names = append(names, w.Name)
+			}
+			assert.Equal(t, tt.workloads, names)
+		})
+	}
+
+	t.Run("get workload", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/workloads/ns1/app/app1", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var w state.Workload
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &w))
+		assert.Equal(t, "uuid1", w.Containers[0].ProjectUuid)
+	})
+
+	t.Run("get unknown workload", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/workloads/ns1/app/app2", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("get workload of other type", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/workloads/ns1/job/app1", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("reject writes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/workloads/ns1/app/app1", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
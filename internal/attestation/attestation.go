@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/google"
@@ -13,6 +15,7 @@ import (
 	"github.com/sigstore/cosign/v2/pkg/oci/remote"
 
 	"slsa-verde/internal/github"
+	"slsa-verde/internal/observability"
 
 	gh "github.com/google/go-containerregistry/pkg/authn/github"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -25,10 +28,9 @@ import (
 	"github.com/sigstore/cosign/v2/pkg/oci"
 	"github.com/sigstore/cosign/v2/pkg/signature"
 	log "github.com/sirupsen/logrus"
-)
-
-const (
-	ErrNoAttestation = "no matching attestations"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ImageMetadata struct {
@@ -129,16 +131,57 @@ func CosignOptions(ctx context.Context, staticKeyRef string, identities []cosign
 	)
 
 	co.RegistryClientOpts = []remote.Option{
-		remote.WithRemoteOptions(ociremote.WithAuthFromKeychain(keychain)),
+		remote.WithRemoteOptions(
+			ociremote.WithAuthFromKeychain(keychain),
+			ociremote.WithTransport(newInstrumentedTransport(ociremote.DefaultTransport)),
+		),
 	}
 
 	return co, nil
 }
 
+// CheckTrustMaterial returns an error if the keys and certificates needed to verify attestations are not loaded
+func (vao *VerifyAttestationOpts) CheckTrustMaterial() error {
+	co := vao.CheckOpts
+	if co == nil {
+		return errors.New("check options not set")
+	}
+	if co.SigVerifier != nil {
+		return nil
+	}
+	if co.RootCerts == nil {
+		return errors.New("no Fulcio root certificates loaded")
+	}
+	if !co.IgnoreTlog && (co.RekorPubKeys == nil || len(co.RekorPubKeys.Keys) == 0) {
+		return errors.New("no Rekor public keys loaded")
+	}
+	if !co.IgnoreSCT && (co.CTLogPubKeys == nil || len(co.CTLogPubKeys.Keys) == 0) {
+		return errors.New("no CT log public keys loaded")
+	}
+	return nil
+}
+
 func (vao *VerifyAttestationOpts) Verify(ctx context.Context, image string) (*ImageMetadata, error) {
+	ctx, span := observability.Tracer().Start(ctx, "Verify", trace.WithAttributes(attribute.String("image", image)))
+	defer span.End()
+
+	metadata, err := vao.verify(ctx, image)
+	span.SetAttributes(attribute.String("verification.status", StatusOf(err).String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if metadata.RekorMetadata != nil {
+		span.SetAttributes(attribute.String("rekor.log_index", metadata.RekorMetadata.LogIndex))
+	}
+	return metadata, nil
+}
+
+func (vao *VerifyAttestationOpts) verify(ctx context.Context, image string) (*ImageMetadata, error) {
 	ref, err := name.ParseReference(image)
 
-	opts := vao.CheckOpts
+	opts := withRegistryContext(ctx, vao.CheckOpts)
 
 	if opts.SigVerifier != nil {
 		vao.KeyRef = vao.StaticKeyRef
@@ -159,15 +202,19 @@ func (vao *VerifyAttestationOpts) Verify(ctx context.Context, image string) (*Im
 	if vao.LocalImage {
 		verified, bVerified, err = cosign.VerifyLocalImageAttestations(ctx, image, opts)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(image, err)
 		}
 	} else {
+		start := time.Now()
 		verified, bVerified, err = cosign.VerifyImageAttestations(ctx, ref, opts)
+		err = classifyError(image, err)
+		observability.VerificationDuration.WithLabelValues(StatusOf(err).String()).Observe(time.Since(start).Seconds())
 		if err != nil {
-			l := vao.Logger.Logger.WithFields(log.Fields{
-				"ref": ref.String(),
+			l := vao.Logger.Logger.WithContext(ctx).WithFields(log.Fields{
+				"ref":    ref.String(),
+				"reason": Reason(err),
 			})
-			if strings.Contains(err.Error(), ErrNoAttestation) {
+			if errors.Is(err, ErrNoAttestation) {
 				l.Debug("no attestations found")
 				return nil, err
 			}
@@ -180,11 +227,11 @@ func (vao *VerifyAttestationOpts) Verify(ctx context.Context, image string) (*Im
 
 	env, err := att.Payload()
 	if err != nil {
-		return nil, fmt.Errorf("get payload: %v", err)
+		return nil, newVerifyError(image, ErrPayloadMalformed, fmt.Errorf("get payload: %w", err))
 	}
 	statement, err = parseEnvelope(env)
 	if err != nil {
-		return nil, fmt.Errorf("parse payload: %v", err)
+		return nil, newVerifyError(image, ErrPayloadMalformed, fmt.Errorf("parse payload: %w", err))
 	}
 	vao.Logger.WithFields(log.Fields{
 		"predicate-type": statement.PredicateType,
@@ -215,6 +262,9 @@ func (vao *VerifyAttestationOpts) Verify(ctx context.Context, image string) (*Im
 		rekorMetadata, err := GetRekorMetadata(rekorBundle)
 		if err != nil {
 			log.Errorf("get rekor metadata: %v", err)
+			observability.RekorMetadataParsed.WithLabelValues("error").Inc()
+		} else {
+			observability.RekorMetadataParsed.WithLabelValues("success").Inc()
 		}
 		imageMetadata.RekorMetadata = rekorMetadata
 	}
@@ -222,6 +272,13 @@ func (vao *VerifyAttestationOpts) Verify(ctx context.Context, image string) (*Im
 	return imageMetadata, nil
 }
 
+// withRegistryContext makes the registry requests done by cosign use ctx, so they are traced and cancelled with it
+func withRegistryContext(ctx context.Context, co *cosign.CheckOpts) *cosign.CheckOpts {
+	opts := *co
+	opts.RegistryClientOpts = append(slices.Clone(co.RegistryClientOpts), remote.WithMoreRemoteOptions(ociremote.WithContext(ctx)))
+	return &opts
+}
+
 func parseEnvelope(dsseEnvelope []byte) (*in_toto.CycloneDXStatement, error) {
 	env := ssldsse.Envelope{}
 	err := json.Unmarshal(dsseEnvelope, &env)
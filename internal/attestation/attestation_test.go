@@ -1,12 +1,16 @@
 package attestation
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
 	"os"
 	"testing"
 
 	"github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/verify"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/signature"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
@@ -72,3 +76,31 @@ func TestParsePayload(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, want, got)
 }
+
+func TestCheckTrustMaterial(t *testing.T) {
+	keys := &cosign.TrustedTransparencyLogPubKeys{Keys: map[string]cosign.TransparencyLogPubKey{"id": {}}}
+	staticKey, err := signature.PublicKeyFromKeyRef(context.Background(), "testdata/cosign.pub")
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		desc    string
+		opts    *cosign.CheckOpts
+		wantErr string
+	}{
+		{desc: "no check options", wantErr: "check options not set"},
+		{desc: "static key", opts: &cosign.CheckOpts{SigVerifier: staticKey}},
+		{desc: "keyless without roots", opts: &cosign.CheckOpts{RekorPubKeys: keys, CTLogPubKeys: keys}, wantErr: "no Fulcio root certificates loaded"},
+		{desc: "keyless without rekor keys", opts: &cosign.CheckOpts{RootCerts: x509.NewCertPool(), CTLogPubKeys: keys}, wantErr: "no Rekor public keys loaded"},
+		{desc: "keyless without ct log keys", opts: &cosign.CheckOpts{RootCerts: x509.NewCertPool(), RekorPubKeys: keys}, wantErr: "no CT log public keys loaded"},
+		{desc: "keyless", opts: &cosign.CheckOpts{RootCerts: x509.NewCertPool(), RekorPubKeys: keys, CTLogPubKeys: keys}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := (&VerifyAttestationOpts{CheckOpts: tc.opts}).CheckTrustMaterial()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
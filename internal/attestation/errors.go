@@ -0,0 +1,161 @@
+package attestation
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+
+	"slsa-verde/internal/breaker"
+)
+
+// Reasons a verification can fail, use errors.Is on the error returned by Verify to tell them apart.
+var (
+	ErrNoAttestation       = errors.New("no matching attestations")
+	ErrIdentityMismatch    = errors.New("certificate identity mismatch")
+	ErrSignatureInvalid    = errors.New("invalid signature")
+	ErrTlogMissing         = errors.New("transparency log entry missing")
+	ErrRegistryAuth        = errors.New("registry authentication failed")
+	ErrRegistryUnreachable = errors.New("registry unreachable")
+	ErrPayloadMalformed    = errors.New("malformed attestation payload")
+)
+
+var reasons = []error{
+	ErrNoAttestation,
+	ErrIdentityMismatch,
+	ErrSignatureInvalid,
+	ErrTlogMissing,
+	ErrRegistryAuth,
+	ErrRegistryUnreachable,
+	ErrPayloadMalformed,
+}
+
+type VerifyError struct {
+	Image  string
+	Reason error
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	if e.Err == nil {
+		return e.Reason.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *VerifyError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// Reason returns the failure reason of a verification error, or nil if the error is not classified.
+func Reason(err error) error {
+	for _, r := range reasons {
+		if errors.Is(err, r) {
+			return r
+		}
+	}
+	return nil
+}
+
+func newVerifyError(image string, reason, err error) error {
+	return &VerifyError{
+		Image:  image,
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+// classifyError maps errors from cosign and the registry client to one of the failure reasons,
+// errors that can not be classified are returned as is.
+func classifyError(image string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		switch transportErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return newVerifyError(image, ErrRegistryAuth, err)
+		default:
+			if transportErr.Temporary() || transportErr.StatusCode >= http.StatusInternalServerError {
+				return newVerifyError(image, ErrRegistryUnreachable, err)
+			}
+			return err
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, breaker.ErrOpen) {
+		return newVerifyError(image, ErrRegistryUnreachable, err)
+	}
+
+	var noMatch *cosign.ErrNoMatchingAttestations
+	var noCert *cosign.ErrNoCertificateFoundOnSignature
+	var failure *cosign.VerificationFailure
+	if errors.As(err, &noMatch) || errors.As(err, &noCert) || errors.As(err, &failure) {
+		return newVerifyError(image, verificationReason(err), err)
+	}
+
+	return err
+}
+
+// Messages of the cosign v2.5.0 verification failures by reason. cosign joins the errors of all attestations it
+// tried into the message of ErrNoMatchingAttestations, so their types are lost and only the message is left.
+var (
+	noAttestationMessages = []string{
+		"no valid bundles exist in registry",
+	}
+	identityMismatchMessages = []string{
+		"none of the expected identities matched what was in the certificate",
+		"expected GitHub Workflow Trigger not found in certificate",
+		"expected GitHub Workflow SHA not found in certificate",
+		"expected GitHub Workflow Name not found in certificate",
+		"expected GitHub Workflow Repository not found in certificate",
+		"expected GitHub Workflow Ref not found in certificate",
+	}
+	tlogMissingMessages = []string{
+		"signature not found in transparency log",
+		"no valid tlog entries found",
+		"offline verification failed",
+	}
+	payloadMalformedMessages = []string{
+		"invalid payloadType",
+		"bundle does not contain a DSSE envelope",
+	}
+)
+
+// verificationReason returns the reason of a verification failure reported by cosign, failures without a known
+// message are reported as invalid signatures, the attestation was found but could not be verified.
+func verificationReason(err error) error {
+	var noCert *cosign.ErrNoCertificateFoundOnSignature
+	if errors.As(err, &noCert) {
+		return ErrSignatureInvalid
+	}
+	msg := err.Error()
+	switch {
+	case strings.TrimSpace(strings.TrimPrefix(msg, ErrNoAttestation.Error()+":")) == "",
+		containsAny(msg, noAttestationMessages):
+		return ErrNoAttestation
+	case containsAny(msg, identityMismatchMessages):
+		return ErrIdentityMismatch
+	case containsAny(msg, tlogMissingMessages):
+		return ErrTlogMissing
+	case containsAny(msg, payloadMalformedMessages):
+		return ErrPayloadMalformed
+	default:
+		return ErrSignatureInvalid
+	}
+}
+
+func containsAny(msg string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/oci/empty"
+	"github.com/stretchr/testify/assert"
+)
+
+// messages of cosign v2.5.0, the errors of the attestations tried are joined into the no matching attestations error
+func TestVerificationReason(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want error
+	}{
+		{
+			desc: "image without attestations",
+			msg:  "no matching attestations: ",
+			want: ErrNoAttestation,
+		},
+		{
+			desc: "image without sigstore bundles",
+			msg:  "no valid bundles exist in registry",
+			want: ErrNoAttestation,
+		},
+		{
+			desc: "attestation signed by another identity",
+			msg:  "no matching attestations: none of the expected identities matched what was in the certificate, got subjects [https://github.com/evil/repo/.github/workflows/main.yml@refs/heads/main] with issuer https://token.actions.githubusercontent.com",
+			want: ErrIdentityMismatch,
+		},
+		{
+			desc: "attestation signed by another workflow",
+			msg:  "no matching attestations: expected GitHub Workflow Repository not found in certificate",
+			want: ErrIdentityMismatch,
+		},
+		{
+			desc: "attestation not found in the transparency log",
+			msg:  "no matching attestations: no valid tlog entries found with proposed entry",
+			want: ErrTlogMissing,
+		},
+		{
+			desc: "transparency log entries not verified",
+			msg:  "no matching attestations: no valid tlog entries found inclusion proof not provided",
+			want: ErrTlogMissing,
+		},
+		{
+			desc: "attestation without bundle verified offline",
+			msg:  "no matching attestations: offline verification failed",
+			want: ErrTlogMissing,
+		},
+		{
+			desc: "attestation with invalid signature",
+			msg:  "no matching attestations: invalid signature when validating ASN.1 encoded signature",
+			want: ErrSignatureInvalid,
+		},
+		{
+			desc: "bundle of another signature mentioning the log",
+			msg:  "no matching attestations: error verifying bundle: verifying bundle: rekor log public key not found for payload",
+			want: ErrSignatureInvalid,
+		},
+		{
+			desc: "certificate expired when the attestation was logged",
+			msg:  "no matching attestations: certificate expired before signatures were entered in log: 2025-05-02T10:10:00Z is before 2025-05-02T10:20:00Z",
+			want: ErrSignatureInvalid,
+		},
+		{
+			desc: "attestation with unexpected payload type",
+			msg:  "no matching attestations: invalid payloadType application/json on envelope. Expected application/vnd.in-toto+json",
+			want: ErrPayloadMalformed,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.want, verificationReason(errors.New(tc.msg)))
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	image := "ttl.sh/nais/my-app:1"
+	for _, tc := range []struct {
+		desc string
+		err  error
+		want error
+	}{
+		{
+			desc: "registry denies access",
+			err:  fmt.Errorf("fetching attestations: %w", &transport.Error{StatusCode: http.StatusUnauthorized}),
+			want: ErrRegistryAuth,
+		},
+		{
+			desc: "registry is failing",
+			err:  &transport.Error{StatusCode: http.StatusBadGateway},
+			want: ErrRegistryUnreachable,
+		},
+		{
+			desc: "cosign finds no attestations",
+			err:  noMatchingAttestations(t),
+			want: ErrNoAttestation,
+		},
+		{
+			desc: "unknown error is not classified",
+			err:  errors.New("something else"),
+			want: nil,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := classifyError(image, tc.err)
+			assert.Equal(t, tc.want, Reason(err))
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+// noMatchingAttestations returns the error of cosign verifying an image without attestations
+func noMatchingAttestations(t *testing.T) error {
+	_, _, err := cosign.VerifyImageAttestation(context.Background(), empty.Signatures(), v1.Hash{}, &cosign.CheckOpts{})
+	var noMatch *cosign.ErrNoMatchingAttestations
+	assert.ErrorAs(t, err, &noMatch)
+	return err
+}
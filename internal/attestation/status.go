@@ -0,0 +1,38 @@
+package attestation
+
+import (
+	"errors"
+)
+
+// Status is the outcome of verifying an image, as reported in metrics and to other systems.
+type Status string
+
+const (
+	StatusVerified          Status = "verified"
+	StatusUnsigned          Status = "unsigned"
+	StatusUntrustedIdentity Status = "untrusted-identity"
+	StatusInvalidSignature  Status = "invalid-signature"
+	StatusRegistryError     Status = "registry-error"
+	StatusPolicyViolation   Status = "policy-violation"
+)
+
+func (s Status) String() string {
+	return string(s)
+}
+
+// StatusOf returns the verification status for the error returned by Verify.
+func StatusOf(err error) Status {
+	switch {
+	case err == nil:
+		return StatusVerified
+	case errors.Is(err, ErrNoAttestation):
+		return StatusUnsigned
+	case errors.Is(err, ErrIdentityMismatch):
+		return StatusUntrustedIdentity
+	case errors.Is(err, ErrSignatureInvalid), errors.Is(err, ErrTlogMissing), errors.Is(err, ErrPayloadMalformed):
+		return StatusInvalidSignature
+	default:
+		// errors we are not able to classify happen while resolving or fetching the image
+		return StatusRegistryError
+	}
+}
@@ -0,0 +1,27 @@
+package attestation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusOf(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		err  error
+		want Status
+	}{
+		{desc: "verified", err: nil, want: StatusVerified},
+		{desc: "no attestation", err: newVerifyError("img", ErrNoAttestation, errors.New("no matching attestations: ")), want: StatusUnsigned},
+		{desc: "identity mismatch", err: newVerifyError("img", ErrIdentityMismatch, errors.New("none of the expected identities")), want: StatusUntrustedIdentity},
+		{desc: "tlog missing", err: newVerifyError("img", ErrTlogMissing, errors.New("no valid tlog entries")), want: StatusInvalidSignature},
+		{desc: "registry auth", err: newVerifyError("img", ErrRegistryAuth, errors.New("401")), want: StatusRegistryError},
+		{desc: "unclassified", err: errors.New("parse reference"), want: StatusRegistryError},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.want, StatusOf(tc.err))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package attestation
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/observability"
+)
+
+// instrumentedTransport records the duration and outcome of every request made to a container registry,
+// failing requests fast while the circuit breaker of the registry host is open
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func newInstrumentedTransport(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := breaker.Default.Get("registry:" + req.URL.Host)
+	if err := b.Allow(); err != nil {
+		observability.RegistryRequestDuration.WithLabelValues(req.URL.Host, "rejected").Observe(0)
+		return nil, err
+	}
+
+	ctx, span := observability.Tracer().Start(req.Context(), "registry "+req.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+	))
+	defer span.End()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	// cancelled requests say nothing about the registry
+	b.Done(err != nil && ctx.Err() == nil || err == nil && resp.StatusCode >= http.StatusInternalServerError)
+	observability.RegistryRequestDuration.WithLabelValues(req.URL.Host, responseOutcome(resp, err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	return resp, err
+}
+
+func responseOutcome(resp *http.Response, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
@@ -0,0 +1,48 @@
+package attestation
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/observability"
+	"slsa-verde/internal/test"
+)
+
+func TestInstrumentedTransport(t *testing.T) {
+	observability.RegistryRequestDuration.Reset()
+	transport := newInstrumentedTransport(test.RoundTripFunc(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Request: req}
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "https://ghcr.io/v2/nais/my-app/manifests/latest", nil)
+	assert.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 1, testutil.CollectAndCount(observability.RegistryRequestDuration, "slsa_registry_request_duration_seconds"))
+}
+
+func TestInstrumentedTransportFailsFastWhileBreakerOpen(t *testing.T) {
+	calls := 0
+	transport := newInstrumentedTransport(test.RoundTripFunc(func(req *http.Request) *http.Response {
+		calls++
+		return &http.Response{StatusCode: http.StatusBadGateway, Request: req}
+	}))
+	roundTrip := func() error {
+		req, err := http.NewRequest(http.MethodGet, "https://unavailable.example.com/v2/", nil)
+		assert.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		return err
+	}
+
+	for range breaker.Default.FailureThreshold {
+		assert.NoError(t, roundTrip())
+	}
+	assert.ErrorIs(t, roundTrip(), breaker.ErrOpen)
+	assert.Equal(t, breaker.Default.FailureThreshold, calls)
+}
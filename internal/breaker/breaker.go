@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"slsa-verde/internal/observability"
+)
+
+// ErrOpen is returned instead of calling a backend while its circuit breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker opens after a number of consecutive failed calls to a backend, failing calls fast until the cooldown has
+// passed. It then lets a single call through, closing again if it succeeds.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+	observability.CircuitBreakerState.WithLabelValues(name).Set(float64(Closed))
+	return b
+}
+
+// Allow returns an error wrapping ErrOpen if the call should not be made
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.setState(HalfOpen)
+	}
+	switch {
+	case b.state == Open, b.state == HalfOpen && b.probing:
+		observability.CircuitBreakerRejected.WithLabelValues(b.name).Inc()
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	case b.state == HalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// Done records the outcome of an allowed call, failed should only be true if the backend is unavailable
+func (b *Breaker) Done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.setState(Closed)
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	observability.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
+
+// Registry holds a breaker per backend, created with the settings of the registry when first used.
+type Registry struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Default is the registry of the breakers of the backends slsa-verde calls
+var Default = NewRegistry(5, 30*time.Second)
+
+func NewRegistry(failureThreshold int, cooldown time.Duration) *Registry {
+	return &Registry{
+		FailureThreshold: failureThreshold,
+		Cooldown:         cooldown,
+		breakers:         make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of the backend
+func (r *Registry) Get(name string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[name]
+	if !ok {
+		b = newBreaker(name, r.FailureThreshold, r.Cooldown)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+// Check returns an error naming the backends with an open breaker, only the named backends if any are given
+func (r *Registry) Check(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var open []string
+	for name, b := range r.breakers {
+		if len(names) > 0 && !slices.Contains(names, name) {
+			continue
+		}
+		if b.State() == Open {
+			open = append(open, name)
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	slices.Sort(open)
+	return fmt.Errorf("%w: %s", ErrOpen, strings.Join(open, ", "))
+}
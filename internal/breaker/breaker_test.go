@@ -0,0 +1,63 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	r := NewRegistry(2, time.Minute)
+	b := r.Get("dependencytrack")
+	b.now = func() time.Time { return now }
+
+	assert.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, Closed, b.State(), "a single failure does not open the breaker")
+
+	assert.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, Open, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+	assert.ErrorIs(t, r.Check(), ErrOpen)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow(), "a probe is let through after the cooldown")
+	assert.Equal(t, HalfOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen, "only a single probe is let through")
+
+	b.Done(true)
+	assert.Equal(t, Open, b.State(), "a failed probe opens the breaker again")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Done(false)
+	assert.Equal(t, Closed, b.State())
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, r.Check())
+}
+
+func TestBreakerResetsFailuresOnSuccess(t *testing.T) {
+	b := NewRegistry(2, time.Minute).Get("v13s")
+
+	b.Done(true)
+	b.Done(false)
+	b.Done(true)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestRegistryCheck(t *testing.T) {
+	r := NewRegistry(1, time.Minute)
+	r.Get("v13s")
+	r.Get("registry:ghcr.io").Done(true)
+	r.Get("dependencytrack").Done(true)
+
+	err := r.Check()
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.EqualError(t, err, "circuit breaker open: dependencytrack, registry:ghcr.io")
+	assert.EqualError(t, r.Check("dependencytrack", "v13s"), "circuit breaker open: dependencytrack")
+	assert.NoError(t, r.Check("v13s"))
+	assert.Same(t, r.Get("v13s"), r.Get("v13s"))
+}
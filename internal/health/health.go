@@ -0,0 +1,198 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check returns an error if the dependency it checks is not healthy.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker runs the readiness and liveness checks of slsa-verde.
+type Checker struct {
+	checks   []namedCheck
+	liveness []namedCheck
+	timeout  time.Duration
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a readiness check, checks must be added before the handlers are served
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// AddLiveness registers a liveness check, it should only fail if restarting the process is the remedy
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.liveness = append(c.liveness, namedCheck{name: name, check: check})
+}
+
+// Run runs all readiness checks concurrently, each bounded by the checker timeout
+func (c *Checker) Run(ctx context.Context) Response {
+	return c.run(ctx, c.checks)
+}
+
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Response {
+	results := make(map[string]CheckResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			result := CheckResult{Status: StatusOK}
+			if err := nc.check(ctx); err != nil {
+				result = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			}
+			mu.Lock()
+			results[nc.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	response := Response{Status: StatusOK, Checks: results}
+	for _, r := range results {
+		if r.Status != StatusOK {
+			response.Status = StatusUnavailable
+		}
+	}
+	return response
+}
+
+// LivenessHandler runs the liveness checks and responds with 503 if any of them fails
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := c.run(r.Context(), c.liveness)
+		status := http.StatusOK
+		if response.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+			log.WithField("package", "health").Warnf("not live: %+v", response.Checks)
+		}
+		writeResponse(w, status, response)
+	})
+}
+
+// ReadinessHandler runs all checks and responds with 503 if any of them fails
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := c.Run(r.Context())
+		status := http.StatusOK
+		if response.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+			log.WithField("package", "health").Debugf("not ready: %+v", response.Checks)
+		}
+		writeResponse(w, status, response)
+	})
+}
+
+// DialCheck checks that a TCP connection can be opened to target, either host:port or a URL
+func DialCheck(target string) Check {
+	address := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		address = u.Host
+		if u.Port() == "" && u.Scheme == "http" {
+			address = net.JoinHostPort(u.Hostname(), "80")
+		} else if u.Port() == "" {
+			address = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return fmt.Errorf("dial %s: %w", address, err)
+		}
+		return conn.Close()
+	}
+}
+
+// Heartbeat tracks the work in progress of the monitor, it is stale once a piece of work has not finished within its max age
+type Heartbeat struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	next     uint64
+	inFlight map[uint64]time.Time
+	last     time.Time
+}
+
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{
+		maxAge:   maxAge,
+		now:      time.Now,
+		inFlight: make(map[uint64]time.Time),
+	}
+}
+
+// Begin records the start of a piece of work, the returned function records its end
+func (h *Heartbeat) Begin() func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.next
+	h.next++
+	h.inFlight[id] = h.now()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.inFlight, id)
+		h.last = h.now()
+	}
+}
+
+// Check returns an error if a piece of work started more than the max age ago has not finished.
+// An idle monitor is live, there is no progress to make without events.
+func (h *Heartbeat) Check(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	for _, started := range h.inFlight {
+		if age := now.Sub(started); age > h.maxAge {
+			return fmt.Errorf("work in progress for %s, last finished at %s", age.Truncate(time.Second), h.last.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.WithField("package", "health").Warnf("write response: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("ok", func(context.Context) error { return nil })
+	handler := checker.ReadinessHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	checker.Add("failing", func(context.Context) error { return errors.New("connection refused") })
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var response Response
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, Response{
+		Status: StatusUnavailable,
+		Checks: map[string]CheckResult{
+			"ok":      {Status: StatusOK},
+			"failing": {Status: StatusUnavailable, Error: "connection refused"},
+			"slow":    {Status: StatusUnavailable, Error: context.DeadlineExceeded.Error()},
+		},
+	}, response)
+}
+
+func TestLivenessHandler(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("failing", func(context.Context) error { return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	checker.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	checker.AddLiveness("stuck", func(context.Context) error { return errors.New("no progress") })
+	rec = httptest.NewRecorder()
+	checker.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHeartbeat(t *testing.T) {
+	now := time.Now()
+	h := NewHeartbeat(time.Minute)
+	h.now = func() time.Time { return now }
+	assert.NoError(t, h.Check(context.Background()))
+
+	done := h.Begin()
+	now = now.Add(30 * time.Second)
+	fast := h.Begin()
+	fast()
+	assert.NoError(t, h.Check(context.Background()))
+
+	// finished work does not hide work that is stuck
+	now = now.Add(time.Minute)
+	assert.Error(t, h.Check(context.Background()))
+
+	done()
+	now = now.Add(time.Hour)
+	assert.NoError(t, h.Check(context.Background()))
+}
+
+func TestDialCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := l.Addr().String()
+
+	assert.NoError(t, DialCheck(address)(context.Background()))
+	assert.NoError(t, DialCheck("http://"+address)(context.Background()))
+
+	assert.NoError(t, l.Close())
+	assert.Error(t, DialCheck(address)(context.Background()))
+}
@@ -0,0 +1,314 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+)
+
+// OutboxCopyAnalyses copies the audit decisions of the previous versions of a project to a new version once it is analysed
+const OutboxCopyAnalyses = "copy-analyses"
+
+const analysisStateNotSet = "NOT_SET"
+
+// Retries of the copies of audit decisions kept in memory by monitors without an outbox
+const (
+	pendingAnalysesInterval   = time.Minute
+	pendingAnalysesMaxBackoff = 10 * time.Minute
+	pendingAnalysesMaxAge     = 24 * time.Hour
+	pendingAnalysesMaxSize    = 1000
+)
+
+// errNotAnalysed makes the outbox retry copying audit decisions until the findings of the new version are available
+var errNotAnalysed = errors.New("project not analysed yet")
+
+// analysisDecision is an audit decision recorded on a finding of a previous version of a project
+type analysisDecision struct {
+	Component     string   `json:"component"`
+	Vulnerability string   `json:"vulnerability"`
+	Version       string   `json:"version"`
+	State         string   `json:"state"`
+	Justification string   `json:"justification,omitempty"`
+	Response      string   `json:"response,omitempty"`
+	Details       string   `json:"details,omitempty"`
+	Comments      []string `json:"comments,omitempty"`
+	Suppressed    bool     `json:"suppressed"`
+}
+
+type copyAnalysesPayload struct {
+	Project   string             `json:"project"`
+	Version   string             `json:"version"`
+	Decisions []analysisDecision `json:"decisions"`
+}
+
+// pendingAnalyses keeps the copies of audit decisions waiting for the analysis of new versions in memory for
+// monitors without an outbox, pending copies are lost on restart.
+type pendingAnalyses struct {
+	mu     sync.Mutex
+	copies map[string]*pendingCopy
+}
+
+type pendingCopy struct {
+	payload     copyAnalysesPayload
+	createdAt   time.Time
+	attempts    int
+	nextAttempt time.Time
+}
+
+func newPendingAnalyses() *pendingAnalyses {
+	return &pendingAnalyses{copies: make(map[string]*pendingCopy)}
+}
+
+// add queues the copy, replacing a pending copy to the same version, it returns false if the queue is full
+func (q *pendingAnalyses) add(payload copyAnalysesPayload) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := payload.Project + "/" + payload.Version
+	if _, ok := q.copies[key]; !ok && len(q.copies) >= pendingAnalysesMaxSize {
+		return false
+	}
+	now := time.Now()
+	q.copies[key] = &pendingCopy{payload: payload, createdAt: now, nextAttempt: now.Add(pendingAnalysesInterval)}
+	return true
+}
+
+// due returns the copies to retry now, dropping the copies older than the max age
+func (q *pendingAnalyses) due(now time.Time, log *logrus.Entry) map[string]*pendingCopy {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	due := make(map[string]*pendingCopy)
+	for key, p := range q.copies {
+		if now.Sub(p.createdAt) > pendingAnalysesMaxAge {
+			log.WithField("key", key).Warnf("dropping copy of audit decisions after %d attempts", p.attempts)
+			delete(q.copies, key)
+			continue
+		}
+		if !now.Before(p.nextAttempt) {
+			due[key] = p
+		}
+	}
+	return due
+}
+
+// done removes the copy if it succeeded, or schedules its next attempt, unless it was replaced meanwhile
+func (q *pendingAnalyses) done(key string, p *pendingCopy, now time.Time, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.copies[key] != p {
+		return
+	}
+	if err == nil {
+		delete(q.copies, key)
+		return
+	}
+	p.attempts++
+	p.nextAttempt = now.Add(min(pendingAnalysesInterval<<min(p.attempts-1, 10), pendingAnalysesMaxBackoff))
+}
+
+// retryPendingAnalyses copies the pending audit decisions every interval until ctx is done
+func (c *Config) retryPendingAnalyses(ctx context.Context) {
+	ticker := time.NewTicker(pendingAnalysesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.copyPendingAnalyses(ctx)
+		}
+	}
+}
+
+func (c *Config) copyPendingAnalyses(ctx context.Context) {
+	now := time.Now()
+	for key, p := range c.pendingAnalyses.due(now, c.logger) {
+		if ctx.Err() != nil {
+			return
+		}
+		payload, err := json.Marshal(p.payload)
+		if err == nil {
+			err = c.replayCopyAnalyses(ctx, payload)
+		}
+		if err != nil && !errors.Is(err, errNotAnalysed) {
+			c.logger.WithField("key", key).Debugf("copy audit decisions: %v", err)
+		}
+		c.pendingAnalyses.done(key, p, now, err)
+	}
+}
+
+// preserveAnalyses defers copying the audit decisions recorded on the previous versions of the project to the new
+// version, before the previous versions are deleted, as the findings of the new version are not available until
+// Dependency-Track has analysed its SBOM. Copies are deferred to the outbox, or kept in memory without one.
+// The decisions are ordered from the most recently superseded version, its decision wins for the same finding.
+func (c *Config) preserveAnalyses(ctx context.Context, projects []*client.Project, projectName, projectVersion string, log *logrus.Entry) {
+	previous := slices.DeleteFunc(slices.Clone(projects), func(p *client.Project) bool {
+		return p.Name != projectName || p.Version == projectVersion
+	})
+	now := time.Now()
+	slices.SortStableFunc(previous, func(a, b *client.Project) int {
+		return supersededAt(b, now).Compare(supersededAt(a, now))
+	})
+
+	var decisions []analysisDecision
+	for _, p := range previous {
+		d, err := c.analysisDecisions(ctx, p)
+		if err != nil {
+			log.Warnf("get audit decisions of version %s: %v", p.Version, err)
+			continue
+		}
+		decisions = append(decisions, d...)
+	}
+	if len(decisions) == 0 {
+		return
+	}
+	payload := copyAnalysesPayload{
+		Project:   projectName,
+		Version:   projectVersion,
+		Decisions: decisions,
+	}
+	if c.outbox == nil {
+		if !c.pendingAnalyses.add(payload) {
+			log.Warnf("dropping %d audit decisions, %d copies are pending already", len(decisions), pendingAnalysesMaxSize)
+			return
+		}
+	} else if err := c.outbox.Add(OutboxCopyAnalyses, projectName+"/"+projectVersion, payload); err != nil {
+		log.Warnf("add %s to outbox: %v", OutboxCopyAnalyses, err)
+		return
+	}
+	log.Debugf("copying %d audit decisions to the new version", len(decisions))
+}
+
+// supersededAt returns when the project was superseded, projects still used by the workload are superseded now
+func supersededAt(p *client.Project, now time.Time) time.Time {
+	if _, at, ok := Superseded(p); ok {
+		return at
+	}
+	return now
+}
+
+// analysisDecisions returns the audit decisions recorded on the findings of the project, including suppressed findings
+func (c *Config) analysisDecisions(ctx context.Context, project *client.Project) ([]analysisDecision, error) {
+	findings, err := c.Client.GetFindings(ctx, project.Uuid, true)
+	if err != nil {
+		return nil, err
+	}
+	var decisions []analysisDecision
+	for _, f := range findings {
+		if !decided(&f.Analysis) {
+			continue
+		}
+		analysis, err := c.Client.GetAnalysisTrail(ctx, project.Uuid, f.Component.UUID, f.Vulnerability.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if analysis == nil {
+			analysis = &f.Analysis
+		}
+		comments := make([]string, 0, len(analysis.AnalysisComments))
+		for _, comment := range analysis.AnalysisComments {
+			comments = append(comments, comment.Comment)
+		}
+		decisions = append(decisions, analysisDecision{
+			Component:     componentKey(&f.Component),
+			Vulnerability: f.Vulnerability.UUID,
+			Version:       project.Version,
+			State:         analysis.AnalysisState,
+			Justification: analysis.AnalysisJustification,
+			Response:      analysis.AnalysisResponse,
+			Details:       analysis.AnalysisDetails,
+			Comments:      comments,
+			Suppressed:    analysis.IsSuppressed,
+		})
+	}
+	return decisions, nil
+}
+
+// replayCopyAnalyses records the audit decisions of the previous versions on the matching findings of the new
+// version that have no decision of their own, findings match on vulnerability and component group and name
+func (c *Config) replayCopyAnalyses(ctx context.Context, payload json.RawMessage) error {
+	var p copyAnalysesPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	project, err := c.Client.GetProject(ctx, p.Project, p.Version)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return errNotAnalysed
+	}
+	findings, err := c.Client.GetFindings(ctx, project.Uuid, true)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		metric, err := c.Client.GetCurrentProjectMetric(ctx, project.Uuid)
+		if err != nil {
+			return err
+		}
+		if metric == nil || metric.Components == 0 {
+			return errNotAnalysed
+		}
+		return nil
+	}
+
+	decisions := make(map[string]analysisDecision, len(p.Decisions))
+	for _, d := range p.Decisions {
+		// the decisions of the most recently superseded version come first
+		key := d.Vulnerability + "|" + d.Component
+		if _, ok := decisions[key]; !ok {
+			decisions[key] = d
+		}
+	}
+	copied := 0
+	for _, f := range findings {
+		d, ok := decisions[f.Vulnerability.UUID+"|"+componentKey(&f.Component)]
+		if !ok || decided(&f.Analysis) {
+			continue
+		}
+		if err := c.Client.RecordAnalysis(ctx, &client.AnalysisRequest{
+			ProjectUUID:           project.Uuid,
+			ComponentUUID:         f.Component.UUID,
+			VulnerabilityUUID:     f.Vulnerability.UUID,
+			AnalysisState:         d.State,
+			AnalysisJustification: d.Justification,
+			AnalysisResponse:      d.Response,
+			AnalysisDetails:       d.Details,
+			Comment:               copiedComment(d),
+			SuppressedBool:        d.Suppressed,
+		}); err != nil {
+			return err
+		}
+		copied++
+	}
+	c.logger.WithFields(logrus.Fields{
+		"project":         p.Project,
+		"project-version": p.Version,
+	}).Infof("copied %d audit decisions of previous versions", copied)
+	return nil
+}
+
+// decided returns whether an audit decision has been recorded for a finding
+func decided(a *client.Analysis) bool {
+	return a.IsSuppressed || a.AnalysisState != "" && a.AnalysisState != analysisStateNotSet
+}
+
+func componentKey(component *client.Component) string {
+	return component.Group + "/" + component.Name
+}
+
+func copiedComment(d analysisDecision) string {
+	comment := fmt.Sprintf("Copied by slsa-verde from version %s", d.Version)
+	if len(d.Comments) == 0 {
+		return comment
+	}
+	return comment + ":\n" + strings.Join(d.Comments, "\n")
+}
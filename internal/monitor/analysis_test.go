@@ -0,0 +1,162 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func finding(component, vulnerability, state string, suppressed bool) *client.Finding {
+	return &client.Finding{
+		Component:     client.Component{UUID: component + "-uuid", Group: "org.example", Name: component},
+		Vulnerability: client.Vulnerability{UUID: vulnerability},
+		Analysis:      client.Analysis{AnalysisState: state, IsSuppressed: suppressed},
+	}
+}
+
+func TestPreserveAnalyses(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	ob := newFakeOutbox()
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithOutbox(ob))
+
+	projects := []*client.Project{
+		{Uuid: "old", Name: "test/nginx", Version: "1.0"},
+		{Uuid: "other", Name: "test/sidecar", Version: "1.0"},
+	}
+	c.On("GetFindings", mock.Anything, "old", true).Return([]*client.Finding{
+		finding("lib-a", "vuln-1", "FALSE_POSITIVE", true),
+		finding("lib-b", "vuln-2", analysisStateNotSet, false),
+	}, nil)
+	c.On("GetAnalysisTrail", mock.Anything, "old", "lib-a-uuid", "vuln-1").Return(&client.Analysis{
+		AnalysisState:         "FALSE_POSITIVE",
+		AnalysisJustification: "CODE_NOT_REACHABLE",
+		AnalysisComments:      []client.AnalysisComment{{Comment: "not used"}},
+		IsSuppressed:          true,
+	}, nil)
+
+	m.preserveAnalyses(context.Background(), projects, "test/nginx", "2.0", m.logger)
+
+	assert.Equal(t, copyAnalysesPayload{
+		Project: "test/nginx",
+		Version: "2.0",
+		Decisions: []analysisDecision{{
+			Component:     "org.example/lib-a",
+			Vulnerability: "vuln-1",
+			Version:       "1.0",
+			State:         "FALSE_POSITIVE",
+			Justification: "CODE_NOT_REACHABLE",
+			Comments:      []string{"not used"},
+			Suppressed:    true,
+		}},
+	}, ob.entries[OutboxCopyAnalyses+"|test/nginx/2.0"])
+}
+
+func TestPreserveAnalysesOrdersVersionsBySupersession(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	ob := newFakeOutbox()
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithOutbox(ob))
+
+	superseded := func(uuid, version string, at int64) *client.Project {
+		return &client.Project{Uuid: uuid, Name: "test/nginx", Version: version, Tags: []client.Tag{
+			{Name: SupersededTagPrefix.With("test|testns|app|testapp")},
+			{Name: SupersededAtTagPrefix.With(strconv.FormatInt(at, 10))},
+		}}
+	}
+	projects := []*client.Project{
+		superseded("oldest", "0.8", 100),
+		{Uuid: "running", Name: "test/nginx", Version: "1.0"},
+		superseded("older", "0.9", 200),
+	}
+	for _, uuid := range []string{"oldest", "running", "older"} {
+		c.On("GetFindings", mock.Anything, uuid, true).Return([]*client.Finding{finding("lib-a", "vuln-1", "NOT_AFFECTED", false)}, nil)
+		c.On("GetAnalysisTrail", mock.Anything, uuid, "lib-a-uuid", "vuln-1").Return(nil, nil)
+	}
+
+	m.preserveAnalyses(context.Background(), projects, "test/nginx", "2.0", m.logger)
+
+	var versions []string
+	for _, d := range ob.entries[OutboxCopyAnalyses+"|test/nginx/2.0"].(copyAnalysesPayload).Decisions {
+		versions = append(versions, d.Version)
+	}
+	assert.Equal(t, []string{"1.0", "0.9", "0.8"}, versions)
+}
+
+func TestPreserveAnalysesWithoutOutbox(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+
+	c.On("GetFindings", mock.Anything, "old", true).Return([]*client.Finding{finding("lib-a", "vuln-1", "NOT_AFFECTED", false)}, nil)
+	c.On("GetAnalysisTrail", mock.Anything, "old", "lib-a-uuid", "vuln-1").Return(nil, nil)
+	m.preserveAnalyses(context.Background(), []*client.Project{{Uuid: "old", Name: "test/nginx", Version: "1.0"}}, "test/nginx", "2.0", m.logger)
+
+	now := time.Now()
+	assert.Empty(t, m.pendingAnalyses.due(now, m.logger))
+	due := m.pendingAnalyses.due(now.Add(pendingAnalysesInterval), m.logger)
+	assert.Len(t, due, 1)
+	p := due["test/nginx/2.0"]
+	assert.Equal(t, "NOT_AFFECTED", p.payload.Decisions[0].State)
+
+	// retried with backoff until the new version is analysed
+	m.pendingAnalyses.done("test/nginx/2.0", p, now, errNotAnalysed)
+	assert.Empty(t, m.pendingAnalyses.due(now.Add(pendingAnalysesInterval/2), m.logger))
+	assert.Len(t, m.pendingAnalyses.due(now.Add(pendingAnalysesInterval), m.logger), 1)
+	m.pendingAnalyses.done("test/nginx/2.0", p, now, nil)
+	assert.Empty(t, m.pendingAnalyses.due(now.Add(pendingAnalysesMaxBackoff), m.logger))
+
+	// dropped after the max age
+	assert.True(t, m.pendingAnalyses.add(copyAnalysesPayload{Project: "test/nginx", Version: "3.0"}))
+	assert.Empty(t, m.pendingAnalyses.due(now.Add(pendingAnalysesMaxAge+time.Hour), m.logger))
+	assert.Empty(t, m.pendingAnalyses.copies)
+}
+
+func TestReplayCopyAnalyses(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+	payload, err := json.Marshal(copyAnalysesPayload{
+		Project: "test/nginx",
+		Version: "2.0",
+		Decisions: []analysisDecision{
+			{Component: "org.example/lib-a", Vulnerability: "vuln-1", Version: "1.0", State: "NOT_AFFECTED", Suppressed: true},
+			{Component: "org.example/lib-b", Vulnerability: "vuln-2", Version: "1.0", State: "EXPLOITABLE"},
+			// an older version decided otherwise
+			{Component: "org.example/lib-a", Vulnerability: "vuln-1", Version: "0.9", State: "EXPLOITABLE"},
+		},
+	})
+	assert.NoError(t, err)
+
+	c.On("GetProject", mock.Anything, "test/nginx", "2.0").Return(&client.Project{Uuid: "new"}, nil)
+
+	t.Run("should retry until the new version is analysed", func(t *testing.T) {
+		c.On("GetFindings", mock.Anything, "new", true).Return(nil, nil).Once()
+		c.On("GetCurrentProjectMetric", mock.Anything, "new").Return(nil, nil).Once()
+
+		assert.ErrorIs(t, m.replayCopyAnalyses(context.Background(), payload), errNotAnalysed)
+	})
+
+	t.Run("should copy decisions to undecided matching findings", func(t *testing.T) {
+		c.On("GetFindings", mock.Anything, "new", true).Return([]*client.Finding{
+			finding("lib-a", "vuln-1", "", false),
+			finding("lib-b", "vuln-2", "IN_TRIAGE", false),
+			finding("lib-c", "vuln-1", "", false),
+		}, nil).Once()
+		c.On("RecordAnalysis", mock.Anything, &client.AnalysisRequest{
+			ProjectUUID:       "new",
+			ComponentUUID:     "lib-a-uuid",
+			VulnerabilityUUID: "vuln-1",
+			AnalysisState:     "NOT_AFFECTED",
+			Comment:           "Copied by slsa-verde from version 1.0",
+			SuppressedBool:    true,
+		}).Return(nil).Once()
+
+		assert.NoError(t, m.replayCopyAnalyses(context.Background(), payload))
+	})
+}
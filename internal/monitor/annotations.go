@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+)
+
+// VerificationAnnotationPrefix is the prefix of the annotations with the verification outcome of each container,
+// the name of the annotation is the container name
+const VerificationAnnotationPrefix = "verification.slsa-verde.nais.io/"
+
+var workloadResources = map[string]schema.GroupVersionResource{
+	"app": appsv1.SchemeGroupVersion.WithResource("deployments"),
+	"job": nais_io_v1.GroupVersion.WithResource("naisjobs"),
+}
+
+type VerificationAnnotation struct {
+	Verified      bool               `json:"verified"`
+	Status        attestation.Status `json:"status"`
+	Image         string             `json:"image"`
+	Digest        string             `json:"digest,omitempty"`
+	PredicateType string             `json:"predicateType,omitempty"`
+	RekorLogIndex string             `json:"rekorLogIndex,omitempty"`
+	ProjectUuid   string             `json:"projectUuid,omitempty"`
+	VerifiedAt    time.Time          `json:"verifiedAt"`
+}
+
+func (c *Config) annotateWorkload(ctx context.Context, workload *Workload, container state.Container) error {
+	if c.k8sClient == nil || workload.Object == nil {
+		return nil
+	}
+
+	resource, ok := workloadResources[workload.Type]
+	if !ok {
+		return fmt.Errorf("unknown workload type %q", workload.Type)
+	}
+
+	// the workload name of a naisjob can differ from the name of the resource
+	obj, err := meta.Accessor(workload.Object)
+	if err != nil {
+		return err
+	}
+
+	patch, err := annotationPatch(container)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.k8sClient.Resource(resource).Namespace(obj.GetNamespace()).Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func annotationPatch(container state.Container) ([]byte, error) {
+	annotation := VerificationAnnotation{
+		Verified:      container.Status == attestation.StatusVerified,
+		Status:        container.Status,
+		Image:         container.Image,
+		Digest:        container.Digest,
+		PredicateType: container.PredicateType,
+		ProjectUuid:   container.ProjectUuid,
+		VerifiedAt:    container.VerifiedAt.UTC().Truncate(time.Second),
+	}
+	if container.Rekor != nil {
+		annotation.RekorLogIndex = container.Rekor.LogIndex
+	}
+
+	value, err := json.Marshal(annotation)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				VerificationAnnotationPrefix + container.Name: string(value),
+			},
+		},
+	})
+}
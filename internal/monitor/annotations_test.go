@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestAnnotateWorkload(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, appsv1.AddToScheme(scheme))
+
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest")
+	k8sClient := dynamicfake.NewSimpleDynamicClient(scheme, deployment)
+	m := NewMonitor(context.Background(), mockmonitor.NewClient(t), nil, mockattestation.NewVerifier(t), cluster, WithWorkloadAnnotations(k8sClient))
+	workload := NewWorkload(deployment)
+
+	verifiedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	err := m.annotateWorkload(context.Background(), workload, state.Container{
+		Name:          "testapp",
+		Image:         "test/nginx:latest",
+		Status:        attestation.StatusVerified,
+		Digest:        "123",
+		PredicateType: "https://cyclonedx.org/bom",
+		Rekor:         rekor,
+		ProjectUuid:   "uuid1",
+		VerifiedAt:    verifiedAt,
+	})
+	assert.NoError(t, err)
+
+	obj, err := k8sClient.Resource(workloadResources["app"]).Namespace("testns").Get(context.Background(), "testapp", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	var annotation VerificationAnnotation
+	assert.NoError(t, json.Unmarshal([]byte(obj.GetAnnotations()[VerificationAnnotationPrefix+"testapp"]), &annotation))
+	assert.Equal(t, VerificationAnnotation{
+		Verified:      true,
+		Status:        attestation.StatusVerified,
+		Image:         "test/nginx:latest",
+		Digest:        "123",
+		PredicateType: "https://cyclonedx.org/bom",
+		RekorLogIndex: "1234",
+		ProjectUuid:   "uuid1",
+		VerifiedAt:    verifiedAt,
+	}, annotation)
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+)
+
+// Reasons of the events recorded on workloads
+const (
+	EventReasonVerified           = "AttestationVerified"
+	EventReasonNoAttestation      = "NoAttestation"
+	EventReasonUntrustedIdentity  = "UntrustedIdentity"
+	EventReasonInvalidSignature   = "InvalidSignature"
+	EventReasonPolicyViolation    = "PolicyViolation"
+	EventReasonVerificationFailed = "VerificationFailed"
+)
+
+func (c *Config) recordEvent(workload *Workload, container state.Container) {
+	if c.recorder == nil || workload.Object == nil {
+		return
+	}
+	eventType, reason, message := event(container)
+	c.recorder.Event(workload.Object, eventType, reason, message)
+}
+
+func event(container state.Container) (eventType, reason, message string) {
+	image := fmt.Sprintf("image %s in container %s", container.Image, container.Name)
+	switch container.Status {
+	case attestation.StatusVerified:
+		message = image + " has a verified SBOM attestation"
+		if container.Rekor != nil && container.Rekor.LogIndex != "" {
+			message += ", Rekor log index " + container.Rekor.LogIndex
+		}
+		return corev1.EventTypeNormal, EventReasonVerified, message
+	case attestation.StatusUnsigned:
+		return corev1.EventTypeWarning, EventReasonNoAttestation, image + " has no SBOM attestation"
+	case attestation.StatusUntrustedIdentity:
+		return corev1.EventTypeWarning, EventReasonUntrustedIdentity, image + " is attested by an untrusted identity: " + container.Error
+	case attestation.StatusInvalidSignature:
+		return corev1.EventTypeWarning, EventReasonInvalidSignature, image + " has an invalid attestation: " + container.Error
+	case attestation.StatusPolicyViolation:
+		return corev1.EventTypeWarning, EventReasonPolicyViolation, image + " has an attestation without an SBOM"
+	default:
+		return corev1.EventTypeWarning, EventReasonVerificationFailed, image + " could not be verified: " + container.Error
+	}
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/notification"
+	"slsa-verde/internal/state"
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestRecordResult(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	m := NewMonitor(context.Background(), mockmonitor.NewClient(t), nil, mockattestation.NewVerifier(t), cluster, WithEventRecorder(recorder))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+	image := workload.Images[0]
+
+	m.recordResult(context.Background(), workload, image, state.Container{Status: attestation.StatusUnsigned, Error: "no matching attestations"})
+	m.recordResult(context.Background(), workload, image, state.Container{Status: attestation.StatusUnsigned, Error: "no matching attestations"})
+	m.recordResult(context.Background(), workload, image, state.Container{Status: attestation.StatusVerified, Digest: "123", Rekor: rekor})
+	m.recordResult(context.Background(), workload, image, state.Container{Status: attestation.StatusVerified, Digest: "123", Rekor: rekor})
+	m.recordResult(context.Background(), workload, image, state.Container{Status: attestation.StatusVerified, Digest: "456"})
+
+	assert.Equal(t, "Warning NoAttestation image test/nginx:latest in container testapp has no SBOM attestation", <-recorder.Events)
+	assert.Equal(t, "Normal AttestationVerified image test/nginx:latest in container testapp has a verified SBOM attestation, Rekor log index 1234", <-recorder.Events)
+	assert.Equal(t, "Normal AttestationVerified image test/nginx:latest in container testapp has a verified SBOM attestation", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestEvent(t *testing.T) {
+	for _, tt := range []struct {
+		status     attestation.Status
+		wantType   string
+		wantReason string
+	}{
+		{status: attestation.StatusVerified, wantType: "Normal", wantReason: EventReasonVerified},
+		{status: attestation.StatusUnsigned, wantType: "Warning", wantReason: EventReasonNoAttestation},
+		{status: attestation.StatusUntrustedIdentity, wantType: "Warning", wantReason: EventReasonUntrustedIdentity},
+		{status: attestation.StatusInvalidSignature, wantType: "Warning", wantReason: EventReasonInvalidSignature},
+		{status: attestation.StatusPolicyViolation, wantType: "Warning", wantReason: EventReasonPolicyViolation},
+		{status: attestation.StatusRegistryError, wantType: "Warning", wantReason: EventReasonVerificationFailed},
+	} {
+		t.Run(tt.status.String(), func(t *testing.T) {
+			eventType, reason, _ := event(state.Container{Status: tt.status})
+			assert.Equal(t, tt.wantType, eventType)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+type fakeNotifier struct {
+	events []notification.Event
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, event notification.Event) {
+	f.events = append(f.events, event)
+}
+
+func TestRecordResultNotifies(t *testing.T) {
+	notifier := &fakeNotifier{}
+	m := NewMonitor(context.Background(), mockmonitor.NewClient(t), nil, mockattestation.NewVerifier(t), cluster, WithNotifier(notifier))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+	image := workload.Images[0]
+	ctx := context.Background()
+
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusUnsigned})
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusUnsigned})
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusRegistryError, Error: "unreachable"})
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusVerified, ProjectUuid: "uuid1", Critical: 1})
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusVerified, ProjectUuid: "uuid1", Critical: 3})
+	m.recordResult(ctx, workload, image, state.Container{Status: attestation.StatusVerified, ProjectUuid: "uuid1", Critical: 2})
+
+	types := make([]notification.Type, 0)
+	for _, e := range notifier.events {
+		assert.Equal(t, "testns", e.Namespace)
+		assert.Equal(t, "testapp", e.Workload)
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []notification.Type{
+		notification.TypeWorkloadUnattested,
+		notification.TypeVerificationFailed,
+		notification.TypeCriticalVulnerabilitiesIncreased,
+	}, types)
+	assert.Equal(t, "unreachable", notifier.events[1].Message)
+	assert.Equal(t, 3, notifier.events[2].Critical)
+	assert.Equal(t, 1, notifier.events[2].PreviousCritical)
+}
@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"golang.org/x/sync/singleflight"
+
+	"slsa-verde/internal/sbomstore"
+)
+
+// HierarchyTagPrefix tags the parent projects slsa-verde maintains for teams and applications
+const HierarchyTagPrefix client.TagPrefix = "hierarchy:"
+
+const (
+	hierarchyTeam        = "team"
+	hierarchyApplication = "application"
+	projectClassifier    = "APPLICATION"
+)
+
+// hierarchy caches the parent projects, they are never deleted by slsa-verde
+type hierarchy struct {
+	// mu guards the map only, lookups of a parent project are shared by concurrent creations under it
+	mu       sync.Mutex
+	projects map[string]*client.Project
+	lookups  singleflight.Group
+}
+
+// WithProjectHierarchy creates the projects of new versions under a parent project per application, itself under a
+// parent project per team, so Dependency-Track aggregates their metrics. The parents are per cluster.
+func WithProjectHierarchy() Option {
+	return func(c *Config) {
+		c.hierarchy = &hierarchy{projects: make(map[string]*client.Project)}
+	}
+}
+
+// IsHierarchyProject returns whether the project is a team or application parent project
+func IsHierarchyProject(project *client.Project) bool {
+	for _, tag := range project.Tags {
+		if strings.HasPrefix(tag.Name, HierarchyTagPrefix.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// createProject creates the project of a new version, under the application parent project if the hierarchy is
+// enabled. The uuid of the parent project is returned with it, empty without the hierarchy.
+func (c *Config) createProject(ctx context.Context, workload *Workload, projectName, projectVersion string, tags []string) (*client.Project, string, error) {
+	if c.hierarchy == nil {
+		p, err := c.Client.CreateProject(ctx, projectName, projectVersion, getGroup(projectName), tags)
+		return p, "", err
+	}
+	parent, err := c.applicationProject(ctx, workload)
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := c.Client.CreateChildProject(ctx, parent, projectName, projectVersion, getGroup(projectName), projectClassifier, tags)
+	return p, parent.Uuid, err
+}
+
+// applicationProject returns the parent project of the application, creating it and the parent project of its team if needed
+func (c *Config) applicationProject(ctx context.Context, workload *Workload) (*client.Project, error) {
+	log := c.logger.WithField("namespace", workload.Namespace)
+	team, err := c.parentProject(ctx, nil, workload.Namespace, "", []string{
+		HierarchyTagPrefix.With(hierarchyTeam),
+		client.TeamTagPrefix.With(workload.Namespace),
+		client.EnvironmentTagPrefix.With(c.Cluster),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.grantAccess(ctx, workload, team, log)
+	application, err := c.parentProject(ctx, team, workload.Namespace+"/"+workload.Name, workload.Namespace, []string{
+		HierarchyTagPrefix.With(hierarchyApplication),
+		client.TeamTagPrefix.With(workload.Namespace),
+		client.EnvironmentTagPrefix.With(c.Cluster),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.grantAccess(ctx, workload, application, log)
+	return application, nil
+}
+
+// parentProject returns the parent project with the name in the cluster, creating it under parent if it does not
+// exist, once for concurrent creations under it
+func (c *Config) parentProject(ctx context.Context, parent *client.Project, name, group string, tags []string) (*client.Project, error) {
+	c.hierarchy.mu.Lock()
+	p, ok := c.hierarchy.projects[name]
+	c.hierarchy.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	// the lookup is shared by the concurrent creations, it must not fail them all if the first one is cancelled
+	lookupCtx := context.WithoutCancel(ctx)
+	v, err, _ := c.hierarchy.lookups.Do(name, func() (any, error) {
+		p, err := c.lookupParentProject(lookupCtx, parent, name, group, tags)
+		if err != nil {
+			return nil, err
+		}
+		c.hierarchy.mu.Lock()
+		defer c.hierarchy.mu.Unlock()
+		c.hierarchy.projects[name] = p
+		return p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*client.Project), nil
+}
+
+func (c *Config) lookupParentProject(ctx context.Context, parent *client.Project, name, group string, tags []string) (*client.Project, error) {
+	p, err := c.Client.GetProject(ctx, name, c.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		if parent == nil {
+			p, err = c.Client.CreateProject(ctx, name, c.Cluster, group, tags)
+		} else {
+			p, err = c.Client.CreateChildProject(ctx, parent, name, c.Cluster, group, projectClassifier, tags)
+		}
+		if errors.Is(err, sbomstore.ErrAlreadyExists) {
+			// created by another instance in the meantime
+			p, err = c.Client.GetProject(ctx, name, c.Cluster)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p == nil {
+		return nil, errors.New("parent project " + name + " not found")
+	}
+	return p, nil
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestCreateProjectUnderApplicationAndTeam(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithProjectHierarchy())
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:1.0"))
+
+	team := &client.Project{Uuid: "team", Name: "testns", Version: cluster, Tags: []client.Tag{{Name: "hierarchy:team"}}}
+	application := &client.Project{Uuid: "application", Name: "testns/testapp", Version: cluster, Tags: []client.Tag{{Name: "hierarchy:application"}}}
+	c.On("GetProject", mock.Anything, "testns", cluster).Return(team, nil).Once()
+	c.On("GetProject", mock.Anything, "testns/testapp", cluster).Return(nil, nil).Once()
+	c.On("CreateChildProject", mock.Anything, team, "testns/testapp", cluster, "testns", "APPLICATION", []string{
+		"hierarchy:application",
+		"team:testns",
+		"env:test",
+	}).Return(application, nil).Once()
+	tags := []string{"workload:test|testns|app|testapp"}
+	c.On("CreateChildProject", mock.Anything, application, "test/nginx", "1.0", "test", "APPLICATION", tags).
+		Return(&client.Project{Uuid: "v1"}, nil).Twice()
+
+	p, parentUuid, err := m.createProject(context.Background(), workload, "test/nginx", "1.0", tags)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", p.Uuid)
+	assert.Equal(t, "application", parentUuid)
+
+	// the parent projects are cached
+	_, _, err = m.createProject(context.Background(), workload, "test/nginx", "1.0", tags)
+	assert.NoError(t, err)
+	c.AssertNumberOfCalls(t, "GetProject", 2)
+}
+
+func TestCreateProjectWithoutHierarchy(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:1.0"))
+
+	c.On("CreateProject", mock.Anything, "test/nginx", "1.0", "test", []string{"env:test"}).
+		Return(&client.Project{Uuid: "v1"}, nil).Once()
+
+	_, parentUuid, err := m.createProject(context.Background(), workload, "test/nginx", "1.0", []string{"env:test"})
+	assert.NoError(t, err)
+	assert.Empty(t, parentUuid)
+}
+
+func TestIsHierarchyProject(t *testing.T) {
+	assert.True(t, IsHierarchyProject(&client.Project{Tags: []client.Tag{{Name: "team:testns"}, {Name: "hierarchy:team"}}}))
+	assert.False(t, IsHierarchyProject(&client.Project{Tags: []client.Tag{{Name: "team:testns"}}}))
+}
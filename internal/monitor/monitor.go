@@ -3,43 +3,162 @@ package monitor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nais/v13s/pkg/api/vulnerabilities/management"
 
 	"github.com/nais/dependencytrack/pkg/client"
 	"github.com/nais/v13s/pkg/api/vulnerabilities"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
 
 	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/notification"
 	"slsa-verde/internal/observability"
+	"slsa-verde/internal/projectindex"
+	"slsa-verde/internal/sbomstore"
+	"slsa-verde/internal/state"
 )
 
+// WorkloadStateLabel is the label of the workloads registered in v13s telling whether they still run
 const (
-	ErrProjectAlreadyExists = "status 409"
+	WorkloadStateLabel      = "workload-state"
+	WorkloadStateRunning    = "running"
+	WorkloadStateScaledDown = "scaled-down"
+	WorkloadStateDeleted    = "deleted"
 )
 
 type Config struct {
 	Client      client.Client
+	Store       *state.Store
 	vulnzClient vulnerabilities.Client
 	Cluster     string
 	verifier    attestation.Verifier
 	logger      *logrus.Entry
 	ctx         context.Context
+	recorder    record.EventRecorder
+	k8sClient   dynamic.Interface
+	reporter    PolicyReporter
+	notifier    Notifier
+	outbox      Outbox
+	retention   Retention
+	rollouts    *rollouts
+	// scaledDownMarker keeps the projects of scaled down workloads
+	scaledDownMarker bool
+	// hierarchy places the projects under parent projects per team and application
+	hierarchy *hierarchy
+	access    PortfolioAccess
+	// provenance records the provenance of images as project properties instead of tags
+	provenance ProvenanceRecorder
+	// pendingAnalyses keeps the copies of audit decisions in memory if there is no outbox
+	pendingAnalyses *pendingAnalyses
+	// indexed projects come from the project index, their metrics are as old as its last refresh
+	indexed bool
+	// activity makes superseded projects inactive
+	activity ProjectActivity
 }
 
-func NewMonitor(ctx context.Context, client client.Client, vulnzClient vulnerabilities.Client, verifier attestation.Verifier, cluster string) *Config {
-	return &Config{
-		Client:      client,
+// Notifier sends notifications about workloads and projects
+type Notifier interface {
+	Notify(ctx context.Context, event notification.Event)
+}
+
+// PolicyReporter publishes the verification state of the workloads in a namespace
+type PolicyReporter interface {
+	Sync(ctx context.Context, namespace string) error
+}
+
+// PortfolioAccess grants the team of a namespace access to the projects of its workloads in Dependency-Track
+type PortfolioAccess interface {
+	Grant(ctx context.Context, namespace string, project *client.Project) error
+	// Forget drops what is remembered of the grants to a deleted project
+	Forget(projectUuid string)
+}
+
+type Option func(*Config)
+
+// WithEventRecorder makes the monitor record the verification outcome of each container as an event on the workload
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(c *Config) {
+		c.recorder = recorder
+	}
+}
+
+// WithWorkloadAnnotations makes the monitor write the verification outcome of each container as an annotation on the workload
+func WithWorkloadAnnotations(k8sClient dynamic.Interface) Option {
+	return func(c *Config) {
+		c.k8sClient = k8sClient
+	}
+}
+
+// WithPolicyReporter makes the monitor sync the policy report of a namespace when its workloads are verified or deleted
+func WithPolicyReporter(reporter PolicyReporter) Option {
+	return func(c *Config) {
+		c.reporter = reporter
+	}
+}
+
+// WithStore makes the monitor record verification results in store instead of a store of its own
+func WithStore(store *state.Store) Option {
+	return func(c *Config) {
+		c.Store = store
+	}
+}
+
+// WithNotifier makes the monitor send notifications when verification fails, projects are created or deleted and
+// critical vulnerabilities increase
+func WithNotifier(notifier Notifier) Option {
+	return func(c *Config) {
+		c.notifier = notifier
+	}
+}
+
+// WithPortfolioAccess grants the team of the namespace of a workload access to the projects of its images
+func WithPortfolioAccess(access PortfolioAccess) Option {
+	return func(c *Config) {
+		c.access = access
+	}
+}
+
+// WithProjectIndex answers the project lookups of the monitor from the index instead of Dependency-Track, the
+// metrics of verified projects are still read from Dependency-Track
+func WithProjectIndex(index *projectindex.Index) Option {
+	return func(c *Config) {
+		c.Client = index
+		c.indexed = true
+	}
+}
+
+func NewMonitor(ctx context.Context, client client.Client, vulnzClient vulnerabilities.Client, verifier attestation.Verifier, cluster string, opts ...Option) *Config {
+	c := &Config{
+		Client:      sbomstore.Wrap(client),
+		Store:       state.NewStore(),
 		vulnzClient: vulnzClient,
 		Cluster:     cluster,
 		verifier:    verifier,
 		logger:      logrus.WithField("package", "monitor"),
 		ctx:         ctx,
+		rollouts:    newRollouts(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	if c.outbox == nil {
+		c.pendingAnalyses = newPendingAnalyses()
+		go c.retryPendingAnalyses(ctx)
+	}
+	return c
 }
 
 func (c *Config) OnDelete(obj any) {
@@ -50,14 +169,28 @@ func (c *Config) OnDelete(obj any) {
 		log.Debug("not a verified workload")
 		return
 	}
+	observability.InformerEvents.WithLabelValues("delete", workload.Type).Inc()
 
-	l := log.WithFields(logrus.Fields{
+	ctx, span := startSpan(c.ctx, "OnDelete", workload)
+	defer span.End()
+
+	l := log.WithContext(ctx).WithFields(logrus.Fields{
 		"workload":  workload.Name,
 		"namespace": workload.Namespace,
 		"type":      workload.Type,
 	})
 
-	projects, err := c.retrieveProjects(workload.GetTag(c.Cluster))
+	stored, _ := c.Store.Get(workload.Namespace, workload.Type, workload.Name)
+	workload.DeleteVerificationStatus()
+	c.Store.Delete(workload.Namespace, workload.Type, workload.Name)
+	c.removeDeferredWrites(workload)
+	c.rollouts.forget(workload.Key(c.Cluster))
+	c.syncPolicyReport(ctx, workload.Namespace, l)
+	if err := c.markWorkload(ctx, workload, stored, WorkloadStateDeleted); err != nil {
+		l.Warnf("mark workload deleted: %v", err)
+	}
+
+	projects, err := c.retrieveProjects(ctx, workload.GetTag(c.Cluster))
 	if err != nil {
 		l.Warnf("retrieve projects: %v", err)
 		return
@@ -67,7 +200,7 @@ func (c *Config) OnDelete(obj any) {
 		"workload-tag": workload.GetTag(c.Cluster),
 	})
 
-	if err := c.tidyWorkloadProjects(projects, workload, ll); err != nil {
+	if err := c.tidyWorkloadProjects(ctx, projects, workload, ll); err != nil {
 		l.Warnf("cleanup workload: %v", err)
 	}
 }
@@ -86,17 +219,22 @@ func (c *Config) OnUpdate(past any, present any) {
 		log.Debug("not verified workload")
 		return
 	}
-
-	l := log.WithFields(logrus.Fields{
-		"workload":  workload.Name,
-		"namespace": workload.Namespace,
-		"type":      workload.Type,
-	})
+	observability.InformerEvents.WithLabelValues("update", workload.Type).Inc()
 
 	if workload.LastSuccessfulResource() && !pastWorkload.LastSuccessfulResource() {
-		if err := c.verifyWorkloadContainers(c.ctx, workload, l); err != nil {
+		ctx, span := startSpan(c.ctx, "OnUpdate", workload)
+		defer span.End()
+
+		l := log.WithContext(ctx).WithFields(logrus.Fields{
+			"workload":  workload.Name,
+			"namespace": workload.Namespace,
+			"type":      workload.Type,
+		})
+
+		if err := c.verifyWorkloadContainers(ctx, workload, l); err != nil {
 			l.Warnf("verify attestation: %v", err)
 		}
+		c.syncPolicyReport(ctx, workload.Namespace, l)
 	}
 }
 
@@ -108,41 +246,66 @@ func (c *Config) OnAdd(obj any) {
 		log.Debug("not a verified workload")
 		return
 	}
+	observability.InformerEvents.WithLabelValues("add", workload.Type).Inc()
 
-	l := log.WithFields(logrus.Fields{
+	if !workload.LastSuccessfulResource() {
+		log.WithFields(logrus.Fields{
+			"workload":  workload.Name,
+			"namespace": workload.Namespace,
+			"type":      workload.Type,
+		}).Debug("workload not successful")
+		return
+	}
+
+	ctx, span := startSpan(c.ctx, "OnAdd", workload)
+	defer span.End()
+
+	l := log.WithContext(ctx).WithFields(logrus.Fields{
 		"workload":  workload.Name,
 		"namespace": workload.Namespace,
 		"type":      workload.Type,
 	})
 
-	if !workload.LastSuccessfulResource() {
-		l.Debug("workload not successful")
+	err := c.verifyWorkloadContainers(ctx, workload, l)
+	// failed verifications are recorded too, the report is synced either way
+	c.syncPolicyReport(ctx, workload.Namespace, l)
+	if err != nil {
+		l.Warnf("verify attestation: %v", err)
 		return
 	}
+}
 
-	if err := c.verifyWorkloadContainers(c.ctx, workload, l); err != nil {
-		l.Warnf("verify attestation: %v", err)
+func (c *Config) syncPolicyReport(ctx context.Context, namespace string, log *logrus.Entry) {
+	if c.reporter == nil {
 		return
 	}
+	if err := c.reporter.Sync(ctx, namespace); err != nil {
+		log.Warnf("sync policy report: %v", err)
+	}
 }
 
-func (c *Config) verifyWorkloadContainers(ctx context.Context, workload *Workload, log *logrus.Entry) error {
+func (c *Config) verifyWorkloadContainers(ctx context.Context, workload *Workload, log *logrus.Entry) (err error) {
+	ctx, span := startSpan(ctx, "verifyWorkloadContainers", workload)
+	defer func() { endSpan(span, err) }()
+
+	if workload.Status.ScaledDown {
+		return c.scaledDown(ctx, workload, log)
+	}
 	for _, image := range workload.Images {
-		var err error
-		if workload.Status.ScaledDown {
-			if err = c.scaledDown(workload, log); err != nil {
-				return err
-			}
-			continue
-		}
 		if err = c.verifyImage(ctx, workload, image, log); err != nil {
+			if c.deferVerifyImage(workload, image, err) {
+				log.Warnf("verify image %s deferred to outbox: %v", image.Name, err)
+				err = nil
+				continue
+			}
 			return err
 		}
+		c.removeDeferredVerifyImage(workload, image)
 	}
 	return nil
 }
 
-func (c *Config) scaledDown(workload *Workload, log *logrus.Entry) error {
+func (c *Config) scaledDown(ctx context.Context, workload *Workload, log *logrus.Entry) error {
 	l := log.WithFields(logrus.Fields{
 		"event":     "scale-down",
 		"workload":  workload.Name,
@@ -150,24 +313,38 @@ func (c *Config) scaledDown(workload *Workload, log *logrus.Entry) error {
 		"type":      workload.Type,
 	})
 	// Deployment is scaled down, we need to look for the workload tag in all found projects
-	p, err := c.retrieveProjects(workload.GetTag(c.Cluster))
+	p, err := c.retrieveProjects(ctx, workload.GetTag(c.Cluster))
 	if err != nil {
 		return err
 	}
 
+	stored, _ := c.Store.Get(workload.Namespace, workload.Type, workload.Name)
+	workload.DeleteVerificationStatus()
+	c.Store.Delete(workload.Namespace, workload.Type, workload.Name)
+	c.removeDeferredWrites(workload)
+	if err := c.markWorkload(ctx, workload, stored, WorkloadStateScaledDown); err != nil {
+		l.Warnf("mark workload scaled down: %v", err)
+	}
+
 	if len(p) == 0 {
 		l.Debug("no projects found for workload tag")
 		return nil
 	}
 
-	if err := c.tidyWorkloadProjects(p, workload, log); err != nil {
+	if c.scaledDownMarker {
+		c.markScaledDown(ctx, p, workload, l)
+		return nil
+	}
+	if err := c.tidyWorkloadProjects(ctx, p, workload, log); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *Config) verifyImage(ctx context.Context, workload *Workload, image Image, log *logrus.Entry) error {
-	var err error
+func (c *Config) verifyImage(ctx context.Context, workload *Workload, image Image, log *logrus.Entry) (err error) {
+	ctx, span := startSpan(ctx, "verifyImage", workload, attribute.String("image", image.Name), attribute.String("container", image.ContainerName))
+	defer func() { endSpan(span, err) }()
+
 	workloadTag := workload.GetTag(c.Cluster)
 	projectName := getProjectName(image.Name)
 	projectVersion := getProjectVersion(image.Name)
@@ -185,42 +362,70 @@ func (c *Config) verifyImage(ctx context.Context, workload *Workload, image Imag
 	})
 
 	if project != nil {
-		if err = c.updateExistingProjectTags(workload, project, image.Name, l); err != nil {
+		if err = c.updateExistingProjectTags(ctx, workload, project, image.Name, l); err != nil {
+			if c.outbox != nil && unavailable(err) {
+				// deferred to the outbox by the caller
+				return err
+			}
 			l.Warnf("update project tags: %v)", err)
 		}
 		// filter projects with the same workload tag and different version
-		projects := c.filterProjects(client.ProjectTagPrefix.With(projectName), project)
+		projects := c.filterProjects(ctx, client.ProjectTagPrefix.With(projectName), project)
 		// cleanup projects with the same workload tag
-		if err = c.tidyWorkloadProjects(projects, workload, l); err != nil {
+		if err = c.supersedeWorkloadProjects(ctx, projects, workload, l); err != nil {
 			return err
 		}
-		if err = c.updateWorkload(projectName, projectVersion, image.ContainerName, workload); err != nil {
+		tags := NewTags()
+		tags.ArrangeByPrefix(project.Tags)
+		digest := tags.GetTagValue(client.DigestTagPrefix)
+		rekor := c.rekorMetadata(ctx, workload, image, project, tags, l)
+		if err = c.updateWorkload(ctx, projectName, projectVersion, image.ContainerName, workload, workloadMetadata(WorkloadStateRunning, attestation.StatusVerified, digest, rekor)); err != nil {
 			log.Warnf("register workload: %v", err)
 		}
+		workload.SetVerificationStatus(image, attestation.StatusVerified)
+		c.recordResult(ctx, workload, image, state.Container{
+			Status:      attestation.StatusVerified,
+			Digest:      digest,
+			Rekor:       rekor,
+			ProjectUuid: project.Uuid,
+			Critical:    c.currentCritical(ctx, project, l),
+		})
 	} else {
 		var metadata *attestation.ImageMetadata
-		metadata, err = c.verifier.Verify(c.ctx, image.Name)
+		metadata, err = c.verifier.Verify(ctx, image.Name)
 		if err != nil {
+			status := attestation.StatusOf(err)
 			workload.SetVulnerabilityCounter("false", image.Name, projectName, nil)
-			if regErr := c.updateWorkload(projectName, projectVersion, image.ContainerName, workload); regErr != nil {
-				log.Warnf("register workload: %v", err)
+			workload.SetVerificationStatus(image, status)
+			c.recordResult(ctx, workload, image, state.Container{Status: status, Error: err.Error()})
+			if regErr := c.updateWorkload(ctx, projectName, projectVersion, image.ContainerName, workload, workloadMetadata(WorkloadStateRunning, status, "", nil)); regErr != nil {
+				log.Warnf("register workload: %v", regErr)
 			}
 
-			if strings.Contains(err.Error(), attestation.ErrNoAttestation) {
+			if errors.Is(err, attestation.ErrNoAttestation) {
 				l.Debugf("skipping, %v", err)
-				if err != nil {
-					l.Debugf("attestation failure: %v", err)
-				}
 				return nil
 				// continue
 			}
-			l.Warnf("verify attestation: %v", err)
+			// the image is not trusted, its status is recorded and the other containers are still verified
+			if status != attestation.StatusRegistryError {
+				l.WithField("reason", attestation.Reason(err)).Warnf("verify attestation: %v", err)
+				return nil
+			}
+			l.WithField("reason", attestation.Reason(err)).Warnf("verify attestation: %v", err)
 			return err
 			// continue
 		}
 
 		if metadata.Statement == nil {
 			l.Warn("metadata is empty, skipping")
+			workload.SetVerificationStatus(image, attestation.StatusPolicyViolation)
+			c.recordResult(ctx, workload, image, state.Container{
+				Status: attestation.StatusPolicyViolation,
+				Digest: metadata.Digest,
+				Rekor:  metadata.RekorMetadata,
+				Error:  "attestation has no statement",
+			})
 			return nil
 			// continue
 		}
@@ -231,73 +436,135 @@ func (c *Config) verifyImage(ctx context.Context, workload *Workload, image Imag
 
 		l.Debug("project does not exist, updating workload ...")
 		var projects []*client.Project
-		projects, err = c.retrieveProjects(workloadTag)
+		projects, err = c.retrieveProjects(ctx, workloadTag)
 		if err != nil {
 			l.Warnf("retrieve project, skipping %v", err)
 			return err
 		}
 
-		if err = c.tidyWorkloadProjects(projects, workload, l); err != nil {
+		// the previous versions are deleted or superseded below, keep their audit decisions for the new version
+		c.preserveAnalyses(ctx, projects, projectName, projectVersion, l)
+		if err = c.supersedeWorkloadProjects(ctx, projects, workload, l); err != nil {
 			return err
 		}
 
-		tags := workload.initWorkloadTags(metadata, c.Cluster, projectName, projectVersion)
+		tags := c.withoutProvenanceTags(workload.initWorkloadTags(metadata, c.Cluster, projectName, projectVersion))
 		var createdP *client.Project
-		createdP, err = c.Client.CreateProject(ctx, projectName, projectVersion, getGroup(projectName), tags)
+		var parentUuid string
+		createdP, parentUuid, err = c.createProject(ctx, workload, projectName, projectVersion, tags)
 		if err != nil {
-			if !strings.Contains(err.Error(), ErrProjectAlreadyExists) {
+			if !errors.Is(err, sbomstore.ErrAlreadyExists) {
 				return err
 			}
 
 			// This is to handle the case when another slsa-verde instance created the same project
 			// before this instance could create it.
 			// In this case, we update the existing project with the workload tag.
-			if err = c.updateExistingProjectTags(workload, createdP, image.Name, l); err != nil {
+			if err = c.updateExistingProjectTags(ctx, workload, createdP, image.Name, l); err != nil {
 				return fmt.Errorf("update project tags, when the project already exists: %w", err)
 			}
 			l.Info("project already exists, updated with workload tag")
+			c.recordResult(ctx, workload, image, state.Container{
+				Status:        attestation.StatusVerified,
+				Digest:        metadata.Digest,
+				PredicateType: metadata.Statement.PredicateType,
+				Rekor:         metadata.RekorMetadata,
+			})
 			return nil
 		}
 
-		if err = c.uploadSBOMToProject(ctx, metadata, projectName, createdP.Uuid, projectVersion); err != nil {
-			return err
+		if err = c.uploadSBOMToProject(ctx, metadata, projectName, parentUuid, projectVersion); err != nil {
+			if !c.deferUploadSBOM(metadata, createdP.Uuid, projectName, parentUuid, projectVersion, err) {
+				return err
+			}
+			l.Warnf("upload sbom deferred to outbox: %v", err)
 		}
 		ll := l.WithFields(logrus.Fields{
 			"project-uuid": createdP.Uuid,
 		})
 		ll.Info("project created with workload tag")
+		c.grantAccess(ctx, workload, createdP, ll)
+		c.recordProvenance(ctx, createdP, metadata.RekorMetadata, ll)
+		c.notify(ctx, workload, state.Container{Name: image.ContainerName, Image: image.Name, Digest: metadata.Digest}, notification.Event{
+			Type:        notification.TypeProjectCreated,
+			Project:     createdP.Name,
+			ProjectUuid: createdP.Uuid,
+		})
 
 		if err = c.Client.TriggerAnalysis(ctx, createdP.Uuid); err != nil {
 			ll.Warnf("trigger analysis: %v", err)
 		}
 
-		if err = c.registerWorkload(createdP.Name, createdP.Version, image.ContainerName, workload, metadata); err != nil {
+		if err = c.registerWorkload(ctx, createdP.Name, createdP.Version, image.ContainerName, workload, metadata); err != nil {
 			ll.Warnf("register workload: %v", err)
 		}
 
 		workload.SetVulnerabilityCounter("true", image.Name, projectName, createdP)
+		workload.SetVerificationStatus(image, attestation.StatusVerified)
+		c.recordResult(ctx, workload, image, state.Container{
+			Status:        attestation.StatusVerified,
+			Digest:        metadata.Digest,
+			PredicateType: metadata.Statement.PredicateType,
+			Rekor:         metadata.RekorMetadata,
+			ProjectUuid:   createdP.Uuid,
+		})
 	}
 	return nil
 }
 
-func (c *Config) updateWorkload(projectName, projectVersion, containerName string, w *Workload) error {
+// recordResult records the verification result of the image in the state store served by the status API,
+// and as an event, annotation and notification unless the same outcome was already recorded for the image
+func (c *Config) recordResult(ctx context.Context, workload *Workload, image Image, container state.Container) {
+	container.Name = image.ContainerName
+	container.Image = image.Name
+	container.VerifiedAt = time.Now()
+
+	var previous state.Container
+	var seen bool
+	if w, ok := c.Store.Get(workload.Namespace, workload.Type, workload.Name); ok {
+		previous, seen = w.Container(container.Name)
+	}
+
+	if seen && previous.ProjectUuid != "" && previous.ProjectUuid == container.ProjectUuid && container.Critical > previous.Critical {
+		c.notify(ctx, workload, container, notification.Event{
+			Type:             notification.TypeCriticalVulnerabilitiesIncreased,
+			Critical:         container.Critical,
+			PreviousCritical: previous.Critical,
+		})
+	}
+
+	if !seen || !previous.SameResult(container) {
+		c.recordEvent(workload, container)
+		c.notifyResult(ctx, workload, container)
+		if err := c.annotateWorkload(ctx, workload, container); err != nil {
+			c.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"workload":  workload.Name,
+				"namespace": workload.Namespace,
+				"type":      workload.Type,
+			}).Warnf("annotate workload: %v", err)
+		}
+	}
+	c.Store.SetContainer(workload.Namespace, workload.Name, workload.Type, container)
+}
+
+func (c *Config) updateWorkload(ctx context.Context, projectName, projectVersion, containerName string, w *Workload, metadata *management.Metadata) error {
 	if c.vulnzClient == nil {
 		c.logger.Debug("vulnerabilities client is not enabled")
 		return nil
 	}
 
-	_, err := c.vulnzClient.RegisterWorkload(c.ctx, &management.RegisterWorkloadRequest{
+	return c.sendRegisterWorkload(ctx, &management.RegisterWorkloadRequest{
 		Cluster:      c.Cluster,
 		Namespace:    w.Namespace,
 		WorkloadType: w.Type,
 		ImageName:    projectName,
 		ImageTag:     projectVersion,
 		Workload:     setWorkloadName(containerName, w.Name),
+		Metadata:     metadata,
 	})
-	return err
 }
 
-func (c *Config) registerWorkload(projectName, projectVersion, containerName string, w *Workload, m *attestation.ImageMetadata) error {
+func (c *Config) registerWorkload(ctx context.Context, projectName, projectVersion, containerName string, w *Workload, m *attestation.ImageMetadata) error {
 	if c.vulnzClient == nil {
 		c.logger.Debug("vulnerabilities client is not enabled")
 		return nil
@@ -317,7 +584,79 @@ func (c *Config) registerWorkload(projectName, projectVersion, containerName str
 		registerRequest.Metadata = buildMetadataFromImageMetadata(m)
 	}
 
-	_, err := c.vulnzClient.RegisterWorkload(c.ctx, registerRequest)
+	return c.sendRegisterWorkload(ctx, registerRequest)
+}
+
+func (c *Config) sendRegisterWorkload(ctx context.Context, request *management.RegisterWorkloadRequest) error {
+	err := sendRegisterWorkload(ctx, c.vulnzClient, request)
+	if c.deferWrite(OutboxRegisterWorkload, registerWorkloadKey(request), request, err) {
+		c.logger.Warnf("register workload deferred to outbox: %v", err)
+		return nil
+	}
+	return err
+}
+
+// markWorkload marks the registrations of the containers of the workload in v13s with the state, stored is the
+// workload as recorded in the store before it was removed
+func (c *Config) markWorkload(ctx context.Context, w *Workload, stored state.Workload, workloadState string) error {
+	if c.vulnzClient == nil {
+		c.logger.Debug("vulnerabilities client is not enabled")
+		return nil
+	}
+
+	var errs []error
+	for _, image := range w.Images {
+		key := w.Key(c.Cluster)
+		key.Name = setWorkloadName(image.ContainerName, w.Name)
+		metadata := c.markedMetadata(ctx, stored, image, workloadState)
+		errs = append(errs, c.sendRegisterWorkload(ctx, markWorkloadRequest(key, getProjectName(image.Name), getProjectVersion(image.Name), metadata)))
+	}
+	return errors.Join(errs...)
+}
+
+// markedMetadata returns the labels of a marked registration from the verification result of the container, or from
+// the project of the image if the container has not been verified since the monitor started
+func (c *Config) markedMetadata(ctx context.Context, stored state.Workload, image Image, workloadState string) *management.Metadata {
+	if container, ok := stored.Container(image.ContainerName); ok && container.Image == image.Name {
+		return workloadMetadata(workloadState, container.Status, container.Digest, container.Rekor)
+	}
+	project, err := c.Client.GetProject(ctx, getProjectName(image.Name), getProjectVersion(image.Name))
+	if err != nil || project == nil {
+		return workloadMetadata(workloadState, "", "", nil)
+	}
+	return projectMetadata(workloadState, project)
+}
+
+// MarkWorkload marks the registration of the workload image in v13s with the state, v13s keeps the registrations
+// of workloads that no longer run until they are marked
+func MarkWorkload(ctx context.Context, vulnzClient vulnerabilities.Client, key WorkloadKey, project *client.Project, state string) error {
+	return sendRegisterWorkload(ctx, vulnzClient, markWorkloadRequest(key, project.Name, project.Version, projectMetadata(state, project)))
+}
+
+func markWorkloadRequest(key WorkloadKey, imageName, imageTag string, metadata *management.Metadata) *management.RegisterWorkloadRequest {
+	return &management.RegisterWorkloadRequest{
+		Cluster:      key.Cluster,
+		Namespace:    key.Namespace,
+		WorkloadType: key.Type,
+		Workload:     key.Name,
+		ImageName:    imageName,
+		ImageTag:     imageTag,
+		Metadata:     metadata,
+	}
+}
+
+func sendRegisterWorkload(ctx context.Context, vulnzClient vulnerabilities.Client, request *management.RegisterWorkloadRequest) error {
+	b := breaker.Default.Get("v13s")
+	if err := b.Allow(); err != nil {
+		// reported as unavailable so the registration is deferred like any other while v13s is down
+		return grpcstatus.Error(codes.Unavailable, err.Error())
+	}
+	ctx, span := observability.Tracer().Start(ctx, "RegisterWorkload", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	_, err := vulnzClient.RegisterWorkload(ctx, request)
+	b.Done(unavailable(err) && ctx.Err() == nil)
+	observability.VulnerabilitiesRequestDuration.WithLabelValues("register_workload", grpcstatus.Code(err).String()).Observe(time.Since(start).Seconds())
+	endSpan(span, err)
 	return err
 }
 
@@ -333,29 +672,49 @@ func setWorkloadName(containerName, workloadName string) string {
 }
 
 func buildMetadataFromImageMetadata(m *attestation.ImageMetadata) *management.Metadata {
-	return &management.Metadata{
-		Labels: map[string]string{
-			"digest":                            m.Digest,
-			"rekor-log-index":                   m.RekorMetadata.LogIndex,
-			"rekor-build-trigger":               m.RekorMetadata.BuildTrigger,
-			"rekor-oidc-issuer":                 m.RekorMetadata.OIDCIssuer,
-			"rekor-github-workflow-name":        m.RekorMetadata.GitHubWorkflowName,
-			"rekor-github-workflow-ref":         m.RekorMetadata.GitHubWorkflowRef,
-			"rekor-github-workflow-sha":         m.RekorMetadata.GitHubWorkflowSHA,
-			"rekor-source-repository-owner-uri": m.RekorMetadata.SourceRepositoryOwnerURI,
-			"rekor-build-config-uri":            m.RekorMetadata.BuildConfigURI,
-			"rekor-run-invocation-uri":          m.RekorMetadata.RunInvocationURI,
-			"rekor-integrated-time":             m.RekorMetadata.IntegratedTime,
-		},
-	}
-}
-
-func (c *Config) updateExistingProjectTags(workload *Workload, project *client.Project, image string, log *logrus.Entry) error {
+	return workloadMetadata(WorkloadStateRunning, attestation.StatusVerified, m.Digest, m.RekorMetadata)
+}
+
+// workloadMetadata returns the labels of a registration in v13s. v13s replaces the labels of a registration, so
+// every registration carries the digest and Rekor metadata of the image, if they are known, next to its state.
+func workloadMetadata(state string, status attestation.Status, digest string, rekor *attestation.Rekor) *management.Metadata {
+	labels := map[string]string{
+		WorkloadStateLabel: state,
+	}
+	if status != "" {
+		labels["verification-status"] = status.String()
+	}
+	if digest != "" {
+		labels["digest"] = digest
+	}
+	if rekor != nil {
+		labels["rekor-log-index"] = rekor.LogIndex
+		labels["rekor-build-trigger"] = rekor.BuildTrigger
+		labels["rekor-oidc-issuer"] = rekor.OIDCIssuer
+		labels["rekor-github-workflow-name"] = rekor.GitHubWorkflowName
+		labels["rekor-github-workflow-ref"] = rekor.GitHubWorkflowRef
+		labels["rekor-github-workflow-sha"] = rekor.GitHubWorkflowSHA
+		labels["rekor-source-repository-owner-uri"] = rekor.SourceRepositoryOwnerURI
+		labels["rekor-build-config-uri"] = rekor.BuildConfigURI
+		labels["rekor-run-invocation-uri"] = rekor.RunInvocationURI
+		labels["rekor-integrated-time"] = rekor.IntegratedTime
+	}
+	return &management.Metadata{Labels: labels}
+}
+
+// projectMetadata returns the labels of a registration of the image of a project, projects exist for verified images only
+func projectMetadata(state string, project *client.Project) *management.Metadata {
+	tags := NewTags()
+	tags.ArrangeByPrefix(project.Tags)
+	return workloadMetadata(state, attestation.StatusVerified, tags.GetTagValue(client.DigestTagPrefix), tags.GetRekorMetadata())
+}
+
+func (c *Config) updateExistingProjectTags(ctx context.Context, workload *Workload, project *client.Project, image string, log *logrus.Entry) error {
 	var err error
 	projectName := getProjectName(image)
 	projectVerion := getProjectVersion(image)
 	if project == nil {
-		project, err = c.Client.GetProject(c.ctx, projectName, projectVerion)
+		project, err = c.Client.GetProject(ctx, projectName, projectVerion)
 		if err != nil {
 			return err
 		}
@@ -371,8 +730,12 @@ func (c *Config) updateExistingProjectTags(workload *Workload, project *client.P
 	tags.ArrangeByPrefix(project.Tags)
 	attest := HasAttestation(project)
 
-	if tags.addWorkloadTag(workloadTag) {
-		_, err = c.Client.UpdateProject(c.ctx, project.Uuid, project.Name, project.Version, project.Group, tags.GetAllTags())
+	// a superseded previous version deployed again, e.g. by a rollback, is current again
+	superseded := tags.deleteSupersededTags()
+	scaledUp := tags.DeleteScaledDownTag(workload.Key(c.Cluster))
+	migrated := c.migrateProvenance(ctx, project, tags, log)
+	if tags.addWorkloadTag(workloadTag) || superseded || scaledUp || migrated {
+		_, err = c.Client.UpdateProject(ctx, project.Uuid, project.Name, project.Version, project.Group, tags.GetAllTags())
 		if err != nil {
 			return err
 		}
@@ -380,11 +743,35 @@ func (c *Config) updateExistingProjectTags(workload *Workload, project *client.P
 			"project-uuid": project.Uuid,
 		})
 		ll.Info("project tagged with workload")
+		if superseded && c.activity != nil {
+			if err := c.activity.SetProjectActive(ctx, project.Uuid, true); err != nil {
+				ll.Warnf("activate project: %v", err)
+			}
+		}
 	}
+	c.grantAccess(ctx, workload, project, log)
 	workload.SetVulnerabilityCounter(strconv.FormatBool(attest), image, projectName, project)
 	return nil
 }
 
+// grantAccess grants the team of the workload access to the project, a failure is retried the next time the
+// workload is verified
+func (c *Config) grantAccess(ctx context.Context, workload *Workload, project *client.Project, log *logrus.Entry) {
+	if c.access == nil {
+		return
+	}
+	if err := c.access.Grant(ctx, workload.Namespace, project); err != nil {
+		log.Warnf("grant portfolio access: %v", err)
+	}
+}
+
+// forgetAccess drops the grants to the deleted project remembered by the portfolio access
+func (c *Config) forgetAccess(project *client.Project) {
+	if c.access != nil {
+		c.access.Forget(project.Uuid)
+	}
+}
+
 func getProjectName(containerImage string) string {
 	if strings.Contains(containerImage, "@") {
 		return strings.Split(containerImage, "@")[0]
@@ -412,8 +799,8 @@ func handleImageDigest(image string) string {
 	return imageArray[1]
 }
 
-func (c *Config) filterProjects(tag string, project *client.Project) []*client.Project {
-	projects, err := c.retrieveProjects(tag)
+func (c *Config) filterProjects(ctx context.Context, tag string, project *client.Project) []*client.Project {
+	projects, err := c.retrieveProjects(ctx, tag)
 	if err != nil {
 		c.logger.Warnf("retrieve projects: %v", err)
 		return nil
@@ -427,9 +814,9 @@ func (c *Config) filterProjects(tag string, project *client.Project) []*client.P
 	return filteredProjects
 }
 
-func (c *Config) retrieveProjects(tagName string) ([]*client.Project, error) {
+func (c *Config) retrieveProjects(ctx context.Context, tagName string) ([]*client.Project, error) {
 	tag := url.QueryEscape(tagName)
-	projects, err := c.Client.GetProjectsByTag(c.ctx, tag)
+	projects, err := c.Client.GetProjectsByTag(ctx, tag)
 	if err != nil {
 		return nil, fmt.Errorf("getting projects from DependencyTrack: %w", err)
 	}
@@ -451,7 +838,13 @@ func (c *Config) retrieveProjects(tagName string) ([]*client.Project, error) {
 	return filteredProjects, nil
 }
 
-func (c *Config) tidyWorkloadProjects(projects []*client.Project, workload *Workload, log *logrus.Entry) error {
+func (c *Config) tidyWorkloadProjects(ctx context.Context, projects []*client.Project, workload *Workload, log *logrus.Entry) error {
+	return c.tidy(ctx, projects, workload, false, log)
+}
+
+// tidy removes the workload from the projects, deleting the projects used by no other workload or keeping them as
+// superseded
+func (c *Config) tidy(ctx context.Context, projects []*client.Project, workload *Workload, supersede bool, log *logrus.Entry) error {
 	var err error
 	workloadTag := workload.GetTag(c.Cluster)
 	for _, p := range projects {
@@ -465,16 +858,30 @@ func (c *Config) tidyWorkloadProjects(projects []*client.Project, workload *Work
 			"has-attestation": attest,
 		})
 
-		if IsThisWorkload(tags, workloadTag) {
-			if err = c.Client.DeleteProject(c.ctx, p.Uuid); err != nil {
+		if IsThisWorkload(tags, workloadTag) && supersede {
+			if err = c.supersede(ctx, p, tags, workload); err != nil {
+				l.Warnf("supersede project: %v", err)
+				continue
+			}
+			l.Info("project superseded")
+			observability.WorkloadWithAttestation.DeleteLabelValues(workload.Namespace, workload.Name, workload.Type, strconv.FormatBool(attest), image)
+		} else if IsThisWorkload(tags, workloadTag) {
+			if err = c.Client.DeleteProject(ctx, p.Uuid); err != nil {
 				l.Warnf("delete project: %v", err)
 				continue
 			}
+			c.forgetAccess(p)
 			l.Info("project deleted")
+			c.notify(ctx, workload, state.Container{Image: image}, notification.Event{
+				Type:        notification.TypeProjectDeleted,
+				Project:     p.Name,
+				ProjectUuid: p.Uuid,
+			})
 			observability.WorkloadWithAttestation.DeleteLabelValues(workload.Namespace, workload.Name, workload.Type, strconv.FormatBool(attest), image)
 		} else if tags.HasWorkload(workloadTag) {
 			tags.DeleteWorkloadTag(workloadTag)
-			_, err = c.Client.UpdateProject(c.ctx, p.Uuid, p.Name, p.Version, p.Group, tags.GetAllTags())
+			tags.DeleteScaledDownTag(workload.Key(c.Cluster))
+			_, err = c.Client.UpdateProject(ctx, p.Uuid, p.Name, p.Version, p.Group, tags.GetAllTags())
 			if err != nil {
 				l.Warnf("remove tags project: %v", err)
 				continue
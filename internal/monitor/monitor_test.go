@@ -16,6 +16,7 @@ import (
 	"github.com/nais/dependencytrack/pkg/client"
 
 	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
 
 	"github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/stretchr/testify/assert"
@@ -83,11 +84,19 @@ func TestConfigOnAdd(t *testing.T) {
 		c.On("CreateProject", mock.Anything, "test/nginx", "latest", "test", tags).Return(&client.Project{
 			Uuid: "uuid1",
 		}, nil)
-		c.On("UploadProject", mock.Anything, "test/nginx", "latest", "uuid1", false, mock.Anything).Return(nil, nil)
+		c.On("UploadProject", mock.Anything, "test/nginx", "latest", "", false, mock.Anything).Return(nil, nil)
 		c.On("TriggerAnalysis", mock.Anything, "uuid1").Return(nil)
 		c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(&client.Project{Uuid: "uuid1"}, nil)
 
 		m.OnAdd(deployment)
+
+		w, ok := m.Store.Get("testns", "app", "testapp")
+		assert.True(t, ok)
+		assert.Len(t, w.Containers, 1)
+		assert.Equal(t, attestation.StatusVerified, w.Containers[0].Status)
+		assert.Equal(t, "uuid1", w.Containers[0].ProjectUuid)
+		assert.Equal(t, "123", w.Containers[0].Digest)
+		assert.Equal(t, rekor, w.Containers[0].Rekor)
 	})
 
 	t.Run("should not create project if no metadata is found", func(t *testing.T) {
@@ -195,7 +204,7 @@ func TestConfigOnAddSeveralProjectsFromContainers(t *testing.T) {
 		v.On("Verify", mock.Anything, deployment.Spec.Template.Spec.Containers[0].Image).Return(att, nil)
 		c.On("GetProjectsByTag", mock.Anything, url.QueryEscape(workload.GetTag(cluster))).Return([]*client.Project{}, nil)
 		c.On("CreateProject", mock.Anything, "test/nginx", "latest", "test", tags).Return(&client.Project{Uuid: "uuid1"}, nil)
-		c.On("UploadProject", mock.Anything, "test/nginx", "latest", "uuid1", false, mock.Anything).Return(nil, nil)
+		c.On("UploadProject", mock.Anything, "test/nginx", "latest", "", false, mock.Anything).Return(nil, nil)
 		c.On("TriggerAnalysis", mock.Anything, "uuid1").Return(nil)
 		c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(&client.Project{Uuid: "uuid1"}, nil)
 		c.On("TriggerAnalysis", mock.Anything, "uuid2").Return(nil)
@@ -212,7 +221,7 @@ func TestConfigOnAddSeveralProjectsFromContainers(t *testing.T) {
 		tags = workload.initWorkloadTags(att, cluster, "test/nginx", "latest2")
 		c.On("CreateProject", mock.Anything, "test/nginx", "latest2", "test", tags).Return(&client.Project{Uuid: "uuid2"}, nil)
 		v.On("Verify", mock.Anything, deployment.Spec.Template.Spec.Containers[1].Image).Return(att, nil)
-		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "uuid2", false, mock.Anything).Return(nil, nil)
+		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "", false, mock.Anything).Return(nil, nil)
 
 		m.OnAdd(deployment)
 	})
@@ -324,10 +333,12 @@ func TestConfigOnAddExistsJobWithNewVersion(t *testing.T) {
 			},
 		}, nil)
 		c.On("DeleteProject", mock.Anything, "uuid1").Return(nil)
+		// the audit decisions of the previous version are kept for the new version
+		c.On("GetFindings", mock.Anything, "uuid1", true).Return(nil, nil)
 
 		tags := workload.initWorkloadTags(att, cluster, "test/nginx", "latest2")
 		c.On("CreateProject", mock.Anything, "test/nginx", "latest2", "test", tags).Return(&client.Project{Uuid: "uuid2"}, nil)
-		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "uuid2", false, mock.Anything).Return(nil, nil)
+		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "", false, mock.Anything).Return(nil, nil)
 		c.On("TriggerAnalysis", mock.Anything, "uuid2").Return(nil)
 
 		m.OnAdd(job)
@@ -407,10 +418,12 @@ func TestConfigOnAddExists(t *testing.T) {
 			},
 		}, nil)
 		c.On("DeleteProject", mock.Anything, "uuid1").Return(nil)
+		// the audit decisions of the previous version are kept for the new version
+		c.On("GetFindings", mock.Anything, "uuid1", true).Return(nil, nil)
 
 		tags := workload.initWorkloadTags(att, cluster, "test/nginx", "latest2")
 		c.On("CreateProject", mock.Anything, "test/nginx", "latest2", "test", tags).Return(&client.Project{Uuid: "uuid2"}, nil)
-		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "uuid2", false, mock.Anything).Return(nil, nil)
+		c.On("UploadProject", mock.Anything, "test/nginx", "latest2", "", false, mock.Anything).Return(nil, nil)
 		c.On("TriggerAnalysis", mock.Anything, "uuid2").Return(nil)
 
 		m.OnAdd(deployment)
@@ -532,6 +545,71 @@ func TestConfigOnDeleteProjectIsNil(t *testing.T) {
 	})
 }
 
+func TestConfigOnDeleteMarksWorkloadDeleted(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	vulnz := &test.VulnerabilitiesClient{}
+	m := NewMonitor(context.Background(), c, vulnz, v, cluster)
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest")
+	workload := NewWorkload(deployment)
+
+	// the workload has not been verified since the start, its labels come from the project
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(&client.Project{
+		Name:    "test/nginx",
+		Version: "latest",
+		Tags:    []client.Tag{{Name: "digest:123"}, {Name: "rekor:1234"}},
+	}, nil)
+	c.On("GetProjectsByTag", mock.Anything, url.QueryEscape(workload.GetTag(cluster))).Return(nil, nil)
+	m.OnDelete(deployment)
+
+	assert.Len(t, vulnz.Registered, 1)
+	assert.Equal(t, "testns", vulnz.Registered[0].Namespace)
+	assert.Equal(t, "testapp", vulnz.Registered[0].Workload)
+	assert.Equal(t, "test/nginx", vulnz.Registered[0].ImageName)
+	assert.Equal(t, "latest", vulnz.Registered[0].ImageTag)
+	assert.Equal(t, WorkloadStateDeleted, vulnz.Registered[0].Metadata.Labels[WorkloadStateLabel])
+	assert.Equal(t, "123", vulnz.Registered[0].Metadata.Labels["digest"])
+	assert.Equal(t, "1234", vulnz.Registered[0].Metadata.Labels["rekor-log-index"])
+
+	// the labels of verified workloads come from their verification result
+	vulnz.Registered = nil
+	m.Store.SetContainer("testns", "testapp", "app", state.Container{Name: "testapp", Image: "test/nginx:latest", Status: attestation.StatusVerified, Digest: "456"})
+	m.OnDelete(deployment)
+	if assert.Len(t, vulnz.Registered, 1) {
+		assert.Equal(t, "456", vulnz.Registered[0].Metadata.Labels["digest"])
+		assert.Equal(t, attestation.StatusVerified.String(), vulnz.Registered[0].Metadata.Labels["verification-status"])
+	}
+}
+
+func TestConfigOnAddExistsRegistersWorkloadWithProvenance(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	vulnz := &test.VulnerabilitiesClient{}
+	m := NewMonitor(context.Background(), c, vulnz, v, cluster)
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest")
+	workload := NewWorkload(deployment)
+	project := &client.Project{
+		Uuid:    "uuid1",
+		Group:   "test",
+		Name:    "test/nginx",
+		Version: "latest",
+		Tags:    []client.Tag{{Name: workload.GetTag(cluster)}, {Name: "project:test/nginx"}, {Name: "image:test/nginx:latest"}, {Name: "version:latest"}, {Name: "digest:123"}, {Name: "rekor:1234"}},
+	}
+
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(project, nil)
+	c.On("GetProjectsByTag", mock.Anything, url.QueryEscape("project:test/nginx")).Return([]*client.Project{project}, nil)
+	m.OnAdd(deployment)
+
+	// v13s replaces the labels of the registration, the digest and Rekor metadata are sent again
+	if assert.Len(t, vulnz.Registered, 1) {
+		labels := vulnz.Registered[0].Metadata.Labels
+		assert.Equal(t, "123", labels["digest"])
+		assert.Equal(t, "1234", labels["rekor-log-index"])
+		assert.Equal(t, attestation.StatusVerified.String(), labels["verification-status"])
+		assert.Equal(t, WorkloadStateRunning, labels[WorkloadStateLabel])
+	}
+}
+
 func TestConfigOnDeleteRemoveTag(t *testing.T) {
 	c := mockmonitor.NewClient(t)
 	v := mockattestation.NewVerifier(t)
@@ -1035,3 +1113,99 @@ func TestProjectAndVersion(t *testing.T) {
 	v = getProjectVersion(image)
 	assert.Equal(t, "20230504-091909-3efbee3@sha256:456d4c3f4b2ae92baf02b2516e025abc44464be9447ea04b163a0c8d091d30b5", v)
 }
+
+type fakeReporter struct {
+	namespaces []string
+}
+
+func (f *fakeReporter) Sync(_ context.Context, namespace string) error {
+	f.namespaces = append(f.namespaces, namespace)
+	return nil
+}
+
+func TestConfigSyncsPolicyReport(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	reporter := &fakeReporter{}
+	m := NewMonitor(context.Background(), c, nil, v, cluster, WithPolicyReporter(reporter))
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest")
+
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(nil, nil)
+	v.On("Verify", mock.Anything, "test/nginx:latest").Return(nil, &attestation.VerifyError{Image: "test/nginx:latest", Reason: attestation.ErrNoAttestation})
+	m.OnAdd(deployment)
+
+	_, ok := m.Store.Get("testns", "app", "testapp")
+	assert.True(t, ok)
+
+	c.On("GetProjectsByTag", mock.Anything, mock.Anything).Return(nil, errors.New("unavailable"))
+	m.OnDelete(deployment)
+
+	_, ok = m.Store.Get("testns", "app", "testapp")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"testns", "testns"}, reporter.namespaces)
+}
+
+func TestUntrustedContainerDoesNotStopVerification(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	m := NewMonitor(context.Background(), c, nil, v, cluster)
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest", "test/nginx:latest2")
+	workload := NewWorkload(deployment)
+
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(nil, nil)
+	c.On("GetProject", mock.Anything, "test/nginx", "latest2").Return(nil, nil)
+	v.On("Verify", mock.Anything, "test/nginx:latest").Return(nil, &attestation.VerifyError{Image: "test/nginx:latest", Reason: attestation.ErrIdentityMismatch}).Once()
+	v.On("Verify", mock.Anything, "test/nginx:latest2").Return(nil, &attestation.VerifyError{Image: "test/nginx:latest2", Reason: attestation.ErrNoAttestation}).Once()
+	assert.NoError(t, m.verifyWorkloadContainers(context.Background(), workload, m.logger))
+	v.AssertNumberOfCalls(t, "Verify", 2)
+
+	// registry failures are returned to be retried
+	v.On("Verify", mock.Anything, "test/nginx:latest").Return(nil, &attestation.VerifyError{Image: "test/nginx:latest", Reason: attestation.ErrRegistryUnreachable}).Once()
+	assert.ErrorIs(t, m.verifyWorkloadContainers(context.Background(), workload, m.logger), attestation.ErrRegistryUnreachable)
+	v.AssertNumberOfCalls(t, "Verify", 3)
+}
+
+type fakeAccess struct {
+	granted []string
+}
+
+func (a *fakeAccess) Grant(_ context.Context, namespace string, project *client.Project) error {
+	a.granted = append(a.granted, namespace+"/"+project.Uuid)
+	return nil
+}
+
+func (a *fakeAccess) Forget(string) {}
+
+func TestUpdateExistingProjectTagsGrantsPortfolioAccess(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	access := &fakeAccess{}
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithPortfolioAccess(access))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+
+	project := &client.Project{
+		Uuid:    "uuid1",
+		Name:    "test/nginx",
+		Version: "latest",
+		Tags:    []client.Tag{{Name: workload.GetTag(cluster)}, {Name: "team:testns"}, {Name: "env:test"}},
+	}
+
+	err := m.updateExistingProjectTags(context.Background(), workload, project, "test/nginx:latest", m.logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testns/uuid1"}, access.granted)
+}
+
+func TestCurrentCriticalOfIndexedProjects(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+	project := &client.Project{Uuid: "uuid1", Metrics: &client.ProjectMetric{Critical: 1}}
+
+	assert.Equal(t, 1, m.currentCritical(context.Background(), project, m.logger))
+
+	// the metrics of indexed projects are as old as the last refresh of the index
+	m.indexed = true
+	c.On("GetCurrentProjectMetric", mock.Anything, "uuid1").Return(&client.ProjectMetric{Critical: 3}, nil).Once()
+	assert.Equal(t, 3, m.currentCritical(context.Background(), project, m.logger))
+
+	c.On("GetCurrentProjectMetric", mock.Anything, "uuid1").Return(nil, errors.New("unavailable")).Once()
+	assert.Equal(t, 1, m.currentCritical(context.Background(), project, m.logger))
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/notification"
+	"slsa-verde/internal/state"
+)
+
+// notifyResult notifies about a container that is not verified
+func (c *Config) notifyResult(ctx context.Context, workload *Workload, container state.Container) {
+	switch container.Status {
+	case attestation.StatusVerified:
+		return
+	case attestation.StatusUnsigned:
+		c.notify(ctx, workload, container, notification.Event{Type: notification.TypeWorkloadUnattested})
+	default:
+		c.notify(ctx, workload, container, notification.Event{Type: notification.TypeVerificationFailed, Message: container.Error})
+	}
+}
+
+// notify fills in the workload and container of the event and sends it
+func (c *Config) notify(ctx context.Context, workload *Workload, container state.Container, event notification.Event) {
+	if c.notifier == nil {
+		return
+	}
+	event.Cluster = c.Cluster
+	event.Namespace = workload.Namespace
+	event.Workload = workload.Name
+	event.WorkloadType = workload.Type
+	event.Container = container.Name
+	event.Image = container.Image
+	event.Digest = container.Digest
+	if container.Status != "" {
+		event.Status = container.Status.String()
+	}
+	if event.ProjectUuid == "" {
+		event.ProjectUuid = container.ProjectUuid
+	}
+	c.notifier.Notify(ctx, event)
+}
+
+// currentCritical returns the critical vulnerabilities of the project, read from Dependency-Track if the project
+// comes from the project index, falling back to the metrics of the project if they cannot be read
+func (c *Config) currentCritical(ctx context.Context, p *client.Project, log *logrus.Entry) int {
+	if !c.indexed || p == nil {
+		return critical(p)
+	}
+	metric, err := c.Client.GetCurrentProjectMetric(ctx, p.Uuid)
+	if err != nil {
+		log.Debugf("get current project metric: %v", err)
+		return critical(p)
+	}
+	if metric == nil {
+		return critical(p)
+	}
+	return metric.Critical
+}
+
+func critical(p *client.Project) int {
+	if p == nil || p.Metrics == nil {
+		return 0
+	}
+	return p.Metrics.Critical
+}
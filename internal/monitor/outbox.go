@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nais/v13s/pkg/api/vulnerabilities/management"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/outbox"
+	"slsa-verde/internal/sbomstore"
+)
+
+// Kinds of the writes deferred to the outbox
+const (
+	// OutboxVerifyImage replays the verification of a workload image, creating or tagging its project
+	OutboxVerifyImage = "verify-image"
+	// OutboxUploadSBOM uploads the SBOM of a project created before the upload failed
+	OutboxUploadSBOM = "upload-sbom"
+	// OutboxRegisterWorkload registers a workload in v13s
+	OutboxRegisterWorkload = "register-workload"
+)
+
+// Outbox persists writes that failed because a backend was unavailable and replays them with backoff
+type Outbox interface {
+	Handle(kind string, handler outbox.Handler)
+	Add(kind, key string, payload any) error
+	Remove(kind, key string) error
+}
+
+type verifyImagePayload struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Image     Image  `json:"image"`
+}
+
+type uploadSBOMPayload struct {
+	ProjectUuid string `json:"projectUuid"`
+	Project     string `json:"project"`
+	Version     string `json:"version"`
+	ParentUuid  string `json:"parentUuid"`
+	Bom         []byte `json:"bom"`
+}
+
+// WithOutbox makes the monitor defer writes to Dependency-Track and v13s failing because they are unavailable to the
+// outbox, replaying them when they recover. Audit decisions of previous versions of projects are copied to new
+// versions through the outbox as well.
+func WithOutbox(o Outbox) Option {
+	return func(c *Config) {
+		c.outbox = o
+		o.Handle(OutboxVerifyImage, c.replayVerifyImage)
+		o.Handle(OutboxUploadSBOM, c.replayUploadSBOM)
+		o.Handle(OutboxRegisterWorkload, c.replayRegisterWorkload)
+		o.Handle(OutboxCopyAnalyses, c.replayCopyAnalyses)
+	}
+}
+
+// deferWrite adds the write to the outbox if it failed because the backend is unavailable, it returns whether it did
+func (c *Config) deferWrite(kind, key string, payload any, err error) bool {
+	if c.outbox == nil || !unavailable(err) {
+		return false
+	}
+	if addErr := c.outbox.Add(kind, key, payload); addErr != nil {
+		c.logger.Warnf("add %s to outbox: %v", kind, addErr)
+		return false
+	}
+	return true
+}
+
+// deferVerifyImage defers the verification of the workload image to the outbox if it failed because a backend is unavailable
+func (c *Config) deferVerifyImage(workload *Workload, image Image, err error) bool {
+	return c.deferWrite(OutboxVerifyImage, verifyImageKey(workload, image), verifyImagePayload{
+		Name:      workload.Name,
+		Namespace: workload.Namespace,
+		Type:      workload.Type,
+		Image:     image,
+	}, err)
+}
+
+// deferUploadSBOM defers the upload of the SBOM of a created project to the outbox if it failed because
+// Dependency-Track is unavailable
+func (c *Config) deferUploadSBOM(metadata *attestation.ImageMetadata, projectUuid, project, parentUuid, projectVersion string, err error) bool {
+	bom, marshalErr := json.Marshal(metadata.Statement.Predicate)
+	if marshalErr != nil {
+		return false
+	}
+	return c.deferWrite(OutboxUploadSBOM, project+"/"+projectVersion, uploadSBOMPayload{
+		ProjectUuid: projectUuid,
+		Project:     project,
+		Version:     projectVersion,
+		ParentUuid:  parentUuid,
+		Bom:         bom,
+	}, err)
+}
+
+// removeDeferredWrites drops the pending verifications of the workload images, e.g. when it is deleted
+func (c *Config) removeDeferredWrites(workload *Workload) {
+	for _, image := range workload.Images {
+		c.removeDeferredVerifyImage(workload, image)
+	}
+}
+
+// removeDeferredVerifyImage drops the pending verification of the workload image, e.g. once it is verified
+func (c *Config) removeDeferredVerifyImage(workload *Workload, image Image) {
+	if c.outbox == nil {
+		return
+	}
+	if err := c.outbox.Remove(OutboxVerifyImage, verifyImageKey(workload, image)); err != nil {
+		c.logger.Warnf("remove %s from outbox: %v", OutboxVerifyImage, err)
+	}
+}
+
+func (c *Config) replayVerifyImage(ctx context.Context, payload json.RawMessage) error {
+	var p verifyImagePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	workload := &Workload{
+		Name:      p.Name,
+		Namespace: p.Namespace,
+		Type:      p.Type,
+		Images:    []Image{p.Image},
+	}
+	l := c.logger.WithField("event", "outbox")
+	// the container was verified with another image since, e.g. after a rollout
+	if w, ok := c.Store.Get(p.Namespace, p.Type, p.Name); ok {
+		if container, ok := w.Container(p.Image.ContainerName); ok && container.Image != p.Image.Name {
+			l.WithField("image", p.Image.Name).Debugf("skipping, container %s runs %s now", container.Name, container.Image)
+			return nil
+		}
+	}
+	return c.verifyImage(ctx, workload, p.Image, l)
+}
+
+func (c *Config) replayUploadSBOM(ctx context.Context, payload json.RawMessage) error {
+	var p uploadSBOMPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	if err := c.Client.UploadProject(ctx, p.Project, p.Version, p.ParentUuid, false, p.Bom); err != nil {
+		return err
+	}
+	if err := c.Client.TriggerAnalysis(ctx, p.ProjectUuid); err != nil {
+		c.logger.Warnf("trigger analysis: %v", err)
+	}
+	return nil
+}
+
+func (c *Config) replayRegisterWorkload(ctx context.Context, payload json.RawMessage) error {
+	var request management.RegisterWorkloadRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return err
+	}
+	if c.vulnzClient == nil {
+		return nil
+	}
+	return sendRegisterWorkload(ctx, c.vulnzClient, &request)
+}
+
+func verifyImageKey(workload *Workload, image Image) string {
+	return workload.Namespace + "/" + workload.Type + "/" + workload.Name + "/" + image.ContainerName + "/" + image.Name
+}
+
+func registerWorkloadKey(request *management.RegisterWorkloadRequest) string {
+	return request.Cluster + "/" + request.Namespace + "/" + request.WorkloadType + "/" + request.Workload + "/" + request.ImageName
+}
+
+// unavailable returns whether err is caused by Dependency-Track, v13s or a registry being unavailable
+func unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sbomstore.ErrUnavailable) || errors.Is(err, attestation.ErrRegistryUnreachable) || errors.Is(err, breaker.ErrOpen) {
+		return true
+	}
+	switch grpcstatus.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/outbox"
+	"slsa-verde/internal/state"
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+type fakeOutbox struct {
+	handlers map[string]outbox.Handler
+	entries  map[string]any
+}
+
+func newFakeOutbox() *fakeOutbox {
+	return &fakeOutbox{handlers: map[string]outbox.Handler{}, entries: map[string]any{}}
+}
+
+func (f *fakeOutbox) Handle(kind string, handler outbox.Handler) {
+	f.handlers[kind] = handler
+}
+
+func (f *fakeOutbox) Add(kind, key string, payload any) error {
+	f.entries[kind+"|"+key] = payload
+	return nil
+}
+
+func (f *fakeOutbox) Remove(kind, key string) error {
+	delete(f.entries, kind+"|"+key)
+	return nil
+}
+
+func TestVerifyImageDeferredToOutbox(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	ob := newFakeOutbox()
+	m := NewMonitor(context.Background(), c, nil, v, cluster, WithOutbox(ob))
+	deployment := test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest")
+	workload := NewWorkload(deployment)
+
+	unavailable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(nil, unavailable)
+
+	err := m.verifyWorkloadContainers(context.Background(), workload, m.logger)
+	assert.NoError(t, err)
+	assert.Equal(t, verifyImagePayload{
+		Name:      "testapp",
+		Namespace: "testns",
+		Type:      "app",
+		Image:     Image{Name: "test/nginx:latest", ContainerName: "testapp"},
+	}, ob.entries[OutboxVerifyImage+"|testns/app/testapp/testapp/test/nginx:latest"])
+	assert.Len(t, ob.handlers, 4)
+
+	// the pending verification is dropped when the workload is deleted
+	c.On("GetProjectsByTag", mock.Anything, mock.Anything).Return(nil, nil)
+	m.OnDelete(deployment)
+	assert.Empty(t, ob.entries)
+}
+
+func TestVerifiedImageRemovedFromOutbox(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	ob := newFakeOutbox()
+	m := NewMonitor(context.Background(), c, nil, v, cluster, WithOutbox(ob))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+	assert.NoError(t, ob.Add(OutboxVerifyImage, verifyImageKey(workload, workload.Images[0]), nil))
+
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(nil, nil)
+	v.On("Verify", mock.Anything, "test/nginx:latest").Return(nil, &attestation.VerifyError{Image: "test/nginx:latest", Reason: attestation.ErrNoAttestation})
+
+	assert.NoError(t, m.verifyWorkloadContainers(context.Background(), workload, m.logger))
+	assert.Empty(t, ob.entries)
+}
+
+func TestReplayVerifyImageSkipsReplacedImage(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	m := NewMonitor(context.Background(), c, nil, v, cluster, WithOutbox(newFakeOutbox()))
+	m.Store.SetContainer("testns", "testapp", "app", state.Container{Name: "testapp", Image: "test/nginx:2.0", Status: attestation.StatusVerified})
+
+	payload, err := json.Marshal(verifyImagePayload{
+		Name:      "testapp",
+		Namespace: "testns",
+		Type:      "app",
+		Image:     Image{Name: "test/nginx:1.0", ContainerName: "testapp"},
+	})
+	assert.NoError(t, err)
+	// no calls to Dependency-Track or the verifier are expected by the mocks
+	assert.NoError(t, m.replayVerifyImage(context.Background(), payload))
+}
+
+func TestReplayUploadSBOMAnalysesCreatedProject(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithOutbox(newFakeOutbox()))
+
+	payload, err := json.Marshal(uploadSBOMPayload{
+		ProjectUuid: "v1",
+		Project:     "test/nginx",
+		Version:     "1.0",
+		ParentUuid:  "application",
+		Bom:         []byte("{}"),
+	})
+	assert.NoError(t, err)
+	c.On("UploadProject", mock.Anything, "test/nginx", "1.0", "application", false, []byte("{}")).Return(nil).Once()
+	c.On("TriggerAnalysis", mock.Anything, "v1").Return(nil).Once()
+	assert.NoError(t, m.replayUploadSBOM(context.Background(), payload))
+}
+
+func TestVerifyImageNotDeferredOnOtherErrors(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	v := mockattestation.NewVerifier(t)
+	ob := newFakeOutbox()
+	m := NewMonitor(context.Background(), c, nil, v, cluster, WithOutbox(ob))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+
+	c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(nil, errors.New("status 401: unauthorized"))
+
+	err := m.verifyWorkloadContainers(context.Background(), workload, m.logger)
+	assert.Error(t, err)
+	assert.Empty(t, ob.entries)
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/attestation"
+)
+
+// ProvenanceRecorder records the provenance of the image of a project as project properties
+type ProvenanceRecorder interface {
+	Record(ctx context.Context, projectUuid string, rekor *attestation.Rekor) error
+	Rekor(ctx context.Context, projectUuid string) (*attestation.Rekor, error)
+}
+
+// WithProvenanceProperties records the provenance of the images as project properties instead of tags, the tags are
+// kept for the digest and Rekor log index identifying the attestation. Projects tagged with their provenance are moved
+// over to properties when they are updated.
+func WithProvenanceProperties(recorder ProvenanceRecorder) Option {
+	return func(c *Config) {
+		c.provenance = recorder
+	}
+}
+
+// withoutProvenanceTags returns the tags without the ones recorded as project properties, if enabled
+func (c *Config) withoutProvenanceTags(tags []string) []string {
+	if c.provenance == nil {
+		return tags
+	}
+	return slices.DeleteFunc(tags, isProvenanceTag)
+}
+
+// recordProvenance records the provenance of the image of a new project, a failure is retried when the project is
+// updated as long as it has no properties
+func (c *Config) recordProvenance(ctx context.Context, project *client.Project, rekor *attestation.Rekor, log *logrus.Entry) {
+	if c.provenance == nil || rekor == nil {
+		return
+	}
+	if err := c.provenance.Record(ctx, project.Uuid, rekor); err != nil {
+		log.Warnf("record provenance: %v", err)
+	}
+}
+
+// migrateProvenance records the provenance the project is tagged with as properties and removes the tags, it returns
+// whether the tags changed
+func (c *Config) migrateProvenance(ctx context.Context, project *client.Project, tags *Tags, log *logrus.Entry) bool {
+	if c.provenance == nil || !tags.hasProvenanceTags() {
+		return false
+	}
+	rekor := tags.GetRekorMetadata()
+	if rekor == nil {
+		return false
+	}
+	if err := c.provenance.Record(ctx, project.Uuid, rekor); err != nil {
+		log.Warnf("record provenance: %v", err)
+		return false
+	}
+	return tags.deleteProvenanceTags()
+}
+
+// rekorMetadata returns the Rekor metadata of the image of an existing project, from its properties if enabled. The
+// metadata recorded for the container is reused as long as the attestation is the same.
+func (c *Config) rekorMetadata(ctx context.Context, workload *Workload, image Image, project *client.Project, tags *Tags, log *logrus.Entry) *attestation.Rekor {
+	rekor := tags.GetRekorMetadata()
+	if c.provenance == nil || rekor == nil || tags.hasProvenanceTags() {
+		return rekor
+	}
+	if w, ok := c.Store.Get(workload.Namespace, workload.Type, workload.Name); ok {
+		if previous, ok := w.Container(image.ContainerName); ok && previous.ProjectUuid == project.Uuid &&
+			previous.Rekor != nil && previous.Rekor.LogIndex == rekor.LogIndex && previous.Rekor.IntegratedTime != "" {
+			return previous.Rekor
+		}
+	}
+	recorded, err := c.provenance.Rekor(ctx, project.Uuid)
+	if err != nil {
+		log.Warnf("get provenance: %v", err)
+		return rekor
+	}
+	if recorded == nil {
+		return rekor
+	}
+	return recorded
+}
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+type fakeProvenance struct {
+	recorded map[string]*attestation.Rekor
+}
+
+func (p *fakeProvenance) Record(_ context.Context, projectUuid string, rekor *attestation.Rekor) error {
+	p.recorded[projectUuid] = rekor
+	return nil
+}
+
+func (p *fakeProvenance) Rekor(_ context.Context, projectUuid string) (*attestation.Rekor, error) {
+	return p.recorded[projectUuid], nil
+}
+
+func TestUpdateExistingProjectTagsMovesProvenanceToProperties(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	recorder := &fakeProvenance{recorded: make(map[string]*attestation.Rekor)}
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithProvenanceProperties(recorder))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+
+	tags := NewTags()
+	tags.OtherTags = attestationTags(&attestation.ImageMetadata{Digest: "123", RekorMetadata: rekor})
+	project := &client.Project{
+		Uuid:    "uuid1",
+		Name:    "test/nginx",
+		Version: "latest",
+		Tags:    []client.Tag{{Name: workload.GetTag(cluster)}, {Name: "team:testns"}, {Name: "env:test"}},
+	}
+	for _, tag := range tags.OtherTags {
+		project.Tags = append(project.Tags, client.Tag{Name: tag})
+	}
+
+	c.On("UpdateProject", mock.Anything, "uuid1", "test/nginx", "latest", "", []string{
+		workload.GetTag(cluster),
+		"team:testns",
+		"env:test",
+		"digest:123",
+		"rekor:" + rekor.LogIndex,
+	}).Return(nil, nil).Once()
+
+	err := m.updateExistingProjectTags(context.Background(), workload, project, "test/nginx:latest", m.logger)
+	assert.NoError(t, err)
+	assert.Equal(t, rekor.GitHubWorkflowRef, recorder.recorded["uuid1"].GitHubWorkflowRef)
+
+	// the provenance is read from the properties once the project is no longer tagged with it
+	migrated := NewTags()
+	migrated.OtherTags = []string{"digest:123", "rekor:" + rekor.LogIndex}
+	image := Image{Name: "test/nginx:latest", ContainerName: "testapp"}
+	assert.Equal(t, rekor.BuildConfigURI, m.rekorMetadata(context.Background(), workload, image, project, migrated, m.logger).BuildConfigURI)
+}
+
+func TestWithoutProvenanceTags(t *testing.T) {
+	metadata := &attestation.ImageMetadata{Digest: "123", RekorMetadata: rekor}
+	m := NewMonitor(context.Background(), mockmonitor.NewClient(t), nil, mockattestation.NewVerifier(t), cluster)
+	assert.Len(t, m.withoutProvenanceTags(attestationTags(metadata)), 11)
+
+	m = NewMonitor(context.Background(), mockmonitor.NewClient(t), nil, mockattestation.NewVerifier(t), cluster,
+		WithProvenanceProperties(&fakeProvenance{}))
+	assert.Equal(t, []string{"digest:123", "rekor:" + rekor.LogIndex}, m.withoutProvenanceTags(attestationTags(metadata)))
+}
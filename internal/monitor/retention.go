@@ -0,0 +1,188 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/notification"
+	"slsa-verde/internal/state"
+)
+
+const (
+	// SupersededTagPrefix tags the projects of previous versions kept by the retention with the workload that ran them
+	SupersededTagPrefix client.TagPrefix = "superseded:"
+	// SupersededAtTagPrefix tags the projects of previous versions with the unix time they were superseded
+	SupersededAtTagPrefix client.TagPrefix = "superseded-at:"
+)
+
+// Retention keeps the projects of the previous versions of a workload instead of deleting them when a new version is
+// verified. A superseded project is kept if it is one of the last Versions superseded or was superseded within MaxAge,
+// the zero value deletes them right away.
+type Retention struct {
+	Versions int
+	MaxAge   time.Duration
+}
+
+func (r Retention) Enabled() bool {
+	return r.Versions > 0 || r.MaxAge > 0
+}
+
+// Superseded returns the workload and the time the project was superseded, false if it is not superseded
+func Superseded(project *client.Project) (WorkloadKey, time.Time, bool) {
+	var key WorkloadKey
+	var at time.Time
+	var ok bool
+	for _, tag := range project.Tags {
+		switch {
+		case strings.HasPrefix(tag.Name, SupersededTagPrefix.String()):
+			key, ok = ParseWorkloadTag(client.WorkloadTagPrefix.With(strings.TrimPrefix(tag.Name, SupersededTagPrefix.String())))
+		case strings.HasPrefix(tag.Name, SupersededAtTagPrefix.String()):
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(tag.Name, SupersededAtTagPrefix.String()), 10, 64); err == nil {
+				at = time.Unix(sec, 0)
+			}
+		}
+	}
+	return key, at, ok
+}
+
+// Expired returns the superseded projects beyond the retention of their workloads, other projects are ignored
+func (r Retention) Expired(projects []*client.Project, now time.Time) []*client.Project {
+	type superseded struct {
+		project *client.Project
+		at      time.Time
+	}
+	byWorkload := make(map[WorkloadKey][]superseded)
+	for _, p := range projects {
+		if key, at, ok := Superseded(p); ok {
+			byWorkload[key] = append(byWorkload[key], superseded{project: p, at: at})
+		}
+	}
+
+	var expired []*client.Project
+	for _, s := range byWorkload {
+		slices.SortFunc(s, func(a, b superseded) int {
+			return b.at.Compare(a.at)
+		})
+		for i, p := range s {
+			if i < r.Versions || r.MaxAge > 0 && now.Sub(p.at) < r.MaxAge {
+				continue
+			}
+			expired = append(expired, p.project)
+		}
+	}
+	return expired
+}
+
+// WithRetention keeps the projects of previous versions of workloads according to the retention
+func WithRetention(r Retention) Option {
+	return func(c *Config) {
+		c.retention = r
+	}
+}
+
+// ProjectActivity sets whether projects are active in Dependency-Track
+type ProjectActivity interface {
+	SetProjectActive(ctx context.Context, projectUuid string, active bool) error
+}
+
+// WithProjectActivity makes superseded projects inactive, leaving them out of the portfolio metrics and notifications
+// of Dependency-Track, and active again when their version is deployed again
+func WithProjectActivity(activity ProjectActivity) Option {
+	return func(c *Config) {
+		c.activity = activity
+	}
+}
+
+// SupersededTag returns the tag of the projects of previous versions of the workload kept by the retention
+func (k WorkloadKey) SupersededTag() string {
+	return SupersededTagPrefix.With(strings.TrimPrefix(k.Tag(), client.WorkloadTagPrefix.String()))
+}
+
+// supersedeWorkloadProjects removes the workload from the projects of its previous versions, projects used by no
+// other workload are kept as superseded by the retention and the ones beyond it are pruned. Versions still running
+// in a ReplicaSet of the workload with ready pods are left alone.
+func (c *Config) supersedeWorkloadProjects(ctx context.Context, projects []*client.Project, workload *Workload, log *logrus.Entry) error {
+	key := workload.Key(c.Cluster)
+	projects = slices.DeleteFunc(slices.Clone(projects), func(p *client.Project) bool {
+		return c.rollouts.running(key, p)
+	})
+	if !c.retention.Enabled() {
+		return c.tidyWorkloadProjects(ctx, projects, workload, log)
+	}
+	if err := c.tidy(ctx, projects, workload, true, log); err != nil {
+		return err
+	}
+	c.pruneSuperseded(ctx, workload, log)
+	return nil
+}
+
+// supersede replaces the workload tag of the project with the superseded tags, keeping its team and environment tags
+func (c *Config) supersede(ctx context.Context, project *client.Project, tags *Tags, workload *Workload) error {
+	tags.WorkloadTags = nil
+	tags.DeleteScaledDownTag(workload.Key(c.Cluster))
+	tags.OtherTags = append(withoutSupersededTags(tags.OtherTags),
+		workload.Key(c.Cluster).SupersededTag(),
+		SupersededAtTagPrefix.With(strconv.FormatInt(time.Now().Unix(), 10)),
+	)
+	if _, err := c.Client.UpdateProject(ctx, project.Uuid, project.Name, project.Version, project.Group, tags.GetAllTags()); err != nil {
+		return err
+	}
+	// after the update, which sends the whole project
+	if c.activity != nil {
+		if err := c.activity.SetProjectActive(ctx, project.Uuid, false); err != nil {
+			return fmt.Errorf("deactivate project: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneSuperseded deletes the superseded projects of the workload beyond the retention
+func (c *Config) pruneSuperseded(ctx context.Context, workload *Workload, log *logrus.Entry) {
+	projects, err := c.retrieveProjects(ctx, workload.Key(c.Cluster).SupersededTag())
+	if err != nil {
+		log.Warnf("retrieve superseded projects: %v", err)
+		return
+	}
+	for _, p := range c.retention.Expired(projects, time.Now()) {
+		l := log.WithFields(logrus.Fields{
+			"project":         p.Name,
+			"project-version": p.Version,
+			"project-uuid":    p.Uuid,
+		})
+		if err := c.Client.DeleteProject(ctx, p.Uuid); err != nil {
+			l.Warnf("prune superseded project: %v", err)
+			continue
+		}
+		c.forgetAccess(p)
+		l.Info("superseded project pruned")
+		tags := NewTags()
+		tags.ArrangeByPrefix(p.Tags)
+		c.notify(ctx, workload, state.Container{Image: tags.GetImageTag()}, notification.Event{
+			Type:        notification.TypeProjectDeleted,
+			Project:     p.Name,
+			ProjectUuid: p.Uuid,
+		})
+	}
+}
+
+// deleteSupersededTags removes the superseded tags, e.g. when a previous version is deployed again.
+// It returns whether the project was superseded.
+func (t *Tags) deleteSupersededTags() bool {
+	other := withoutSupersededTags(t.OtherTags)
+	deleted := len(other) != len(t.OtherTags)
+	t.OtherTags = other
+	return deleted
+}
+
+func withoutSupersededTags(tags []string) []string {
+	return slices.DeleteFunc(slices.Clone(tags), func(tag string) bool {
+		return strings.HasPrefix(tag, SupersededTagPrefix.String()) || strings.HasPrefix(tag, SupersededAtTagPrefix.String())
+	})
+}
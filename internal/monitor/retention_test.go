@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func supersededProject(uuid, workload string, at time.Time) *client.Project {
+	return &client.Project{
+		Uuid:    uuid,
+		Name:    "test/nginx",
+		Version: uuid,
+		Tags: []client.Tag{
+			{Name: "superseded:" + workload},
+			{Name: "superseded-at:" + strconv.FormatInt(at.Unix(), 10)},
+		},
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	projects := []*client.Project{
+		supersededProject("v1", "test|testns|app|a", now.Add(-72*time.Hour)),
+		supersededProject("v2", "test|testns|app|a", now.Add(-48*time.Hour)),
+		supersededProject("v3", "test|testns|app|a", now.Add(-time.Hour)),
+		supersededProject("b1", "test|testns|app|b", now.Add(-72*time.Hour)),
+		{Uuid: "current", Tags: []client.Tag{{Name: "workload:test|testns|app|a"}}},
+	}
+	uuids := func(projects []*client.Project) []string {
+		var u []string
+		for _, p := range projects {
+			u = append(u, p.Uuid)
+		}
+		slices.Sort(u)
+		return u
+	}
+
+	for _, tt := range []struct {
+		name      string
+		retention Retention
+		want      []string
+	}{
+		{name: "last versions", retention: Retention{Versions: 2}, want: []string{"v1"}},
+		{name: "max age", retention: Retention{MaxAge: 24 * time.Hour}, want: []string{"b1", "v1", "v2"}},
+		{name: "last versions or max age", retention: Retention{Versions: 1, MaxAge: 50 * time.Hour}, want: []string{"v1"}},
+		{name: "disabled", retention: Retention{}, want: []string{"b1", "v1", "v2", "v3"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, uuids(tt.retention.Expired(projects, now)))
+		})
+	}
+}
+
+// fakeActivity records whether projects were made active
+type fakeActivity map[string]bool
+
+func (f fakeActivity) SetProjectActive(_ context.Context, projectUuid string, active bool) error {
+	f[projectUuid] = active
+	return nil
+}
+
+func TestSupersedeWorkloadProjects(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	activity := fakeActivity{}
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithRetention(Retention{Versions: 1}), WithProjectActivity(activity))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:2.0"))
+
+	previous := &client.Project{
+		Uuid:    "v1",
+		Name:    "test/nginx",
+		Version: "1.0",
+		Tags: []client.Tag{
+			{Name: "workload:test|testns|app|testapp"},
+			{Name: "team:testns"},
+			{Name: "env:test"},
+			{Name: "image:test/nginx:1.0"},
+		},
+	}
+	c.On("UpdateProject", mock.Anything, "v1", "test/nginx", "1.0", "", mock.MatchedBy(func(tags []string) bool {
+		return len(tags) == 5 &&
+			slices.Contains(tags, "team:testns") &&
+			slices.Contains(tags, "env:test") &&
+			slices.Contains(tags, "superseded:test|testns|app|testapp") &&
+			!slices.Contains(tags, "workload:test|testns|app|testapp")
+	})).Return(nil, nil)
+	c.On("GetProjectsByTag", mock.Anything, "superseded%3Atest%7Ctestns%7Capp%7Ctestapp").Return([]*client.Project{
+		supersededProject("v0", "test|testns|app|testapp", time.Now().Add(-time.Hour)),
+		supersededProject("v1", "test|testns|app|testapp", time.Now()),
+	}, nil)
+	c.On("DeleteProject", mock.Anything, "v0").Return(nil)
+
+	err := m.supersedeWorkloadProjects(context.Background(), []*client.Project{previous}, workload, m.logger)
+	assert.NoError(t, err)
+	c.AssertNumberOfCalls(t, "DeleteProject", 1)
+	assert.Equal(t, fakeActivity{"v1": false}, activity)
+}
+
+func TestUpdateExistingProjectTagsRestoresSupersededProject(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	activity := fakeActivity{}
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithRetention(Retention{Versions: 1}), WithProjectActivity(activity))
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:1.0"))
+
+	project := supersededProject("v1", "test|testns|app|testapp", time.Now())
+	project.Tags = append(project.Tags, client.Tag{Name: "team:testns"}, client.Tag{Name: "env:test"})
+	c.On("UpdateProject", mock.Anything, "v1", "test/nginx", "v1", "", []string{
+		"workload:test|testns|app|testapp",
+		"team:testns",
+		"env:test",
+	}).Return(nil, nil)
+
+	err := m.updateExistingProjectTags(context.Background(), workload, project, "test/nginx:1.0", m.logger)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeActivity{"v1": true}, activity)
+}
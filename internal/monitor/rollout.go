@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"slsa-verde/internal/observability"
+)
+
+// rollouts tracks the images of the ReplicaSets with ready pods of each Deployment, during a rolling update or a
+// canary both the old and the new ReplicaSet serve traffic
+type rollouts struct {
+	mu          sync.Mutex
+	replicaSets map[WorkloadKey]map[string][]Image
+}
+
+func newRollouts() *rollouts {
+	return &rollouts{replicaSets: make(map[WorkloadKey]map[string][]Image)}
+}
+
+// set tracks the images of a ReplicaSet with ready pods, it returns false if they were already tracked
+func (r *rollouts) set(key WorkloadKey, replicaSet string, images []Image) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replicaSets[key] == nil {
+		r.replicaSets[key] = make(map[string][]Image)
+	}
+	if previous, ok := r.replicaSets[key][replicaSet]; ok && slices.Equal(previous, images) {
+		return false
+	}
+	r.replicaSets[key][replicaSet] = images
+	return true
+}
+
+// remove stops tracking a ReplicaSet, it returns its images and whether other ReplicaSets of the Deployment have ready pods
+func (r *rollouts) remove(key WorkloadKey, replicaSet string) ([]Image, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	images, ok := r.replicaSets[key][replicaSet]
+	if !ok {
+		return nil, len(r.replicaSets[key]) > 0
+	}
+	delete(r.replicaSets[key], replicaSet)
+	if len(r.replicaSets[key]) == 0 {
+		delete(r.replicaSets, key)
+		return images, false
+	}
+	return images, true
+}
+
+// forget stops tracking the ReplicaSets of a Deployment, e.g. when it is deleted
+func (r *rollouts) forget(key WorkloadKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.replicaSets, key)
+}
+
+// running returns whether a ReplicaSet of the Deployment with ready pods runs the project
+func (r *rollouts) running(key WorkloadKey, project *client.Project) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, images := range r.replicaSets[key] {
+		for _, image := range images {
+			if getProjectName(image.Name) == project.Name && getProjectVersion(image.Name) == project.Version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Config) OnReplicaSetAdd(obj any) {
+	c.onReplicaSet(obj, false)
+}
+
+func (c *Config) OnReplicaSetUpdate(_ any, present any) {
+	c.onReplicaSet(present, false)
+}
+
+func (c *Config) OnReplicaSetDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	c.onReplicaSet(obj, true)
+}
+
+// onReplicaSet tags the projects of the images of a ReplicaSet of a Deployment to the Deployment once it has ready
+// pods, and removes the tag when it no longer has any while other ReplicaSets of the Deployment still do. Deployments
+// without ready pods are scaled down or deleted, which is handled by the events of the Deployment.
+func (c *Config) onReplicaSet(obj any, deleted bool) {
+	rs, ok := obj.(*appsv1.ReplicaSet)
+	if !ok {
+		return
+	}
+	owner := metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return
+	}
+	observability.InformerEvents.WithLabelValues("replicaset", "app").Inc()
+
+	images := make([]Image, 0, len(rs.Spec.Template.Spec.Containers))
+	for _, container := range rs.Spec.Template.Spec.Containers {
+		images = append(images, Image{Name: container.Image, ContainerName: container.Name})
+	}
+	workload := &Workload{
+		Name:      owner.Name,
+		Namespace: rs.Namespace,
+		Type:      "app",
+		Images:    images,
+	}
+	key := workload.Key(c.Cluster)
+
+	ctx, span := startSpan(c.ctx, "onReplicaSet", workload)
+	defer span.End()
+	l := c.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"event":      "replicaset",
+		"workload":   workload.Name,
+		"namespace":  workload.Namespace,
+		"type":       workload.Type,
+		"replicaset": rs.Name,
+	})
+
+	if !deleted && rs.Status.ReadyReplicas > 0 {
+		if !c.rollouts.set(key, rs.Name, images) {
+			return
+		}
+		for _, image := range images {
+			if err := c.trackRolloutImage(ctx, workload, image, l); err != nil {
+				l.Warnf("track image %s: %v", image.Name, err)
+			}
+		}
+		return
+	}
+
+	released, rollingOut := c.rollouts.remove(key, rs.Name)
+	if !rollingOut {
+		return
+	}
+	for _, image := range released {
+		if err := c.releaseRolloutImage(ctx, workload, image, l); err != nil {
+			l.Warnf("release image %s: %v", image.Name, err)
+		}
+	}
+}
+
+// trackRolloutImage tags the project of an image with ready pods to the workload, verifying the image if it has no project
+func (c *Config) trackRolloutImage(ctx context.Context, workload *Workload, image Image, log *logrus.Entry) error {
+	project, err := c.Client.GetProject(ctx, getProjectName(image.Name), getProjectVersion(image.Name))
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		if err := c.verifyImage(ctx, workload, image, log); err != nil && !c.deferVerifyImage(workload, image, err) {
+			return err
+		}
+		return nil
+	}
+	return c.updateExistingProjectTags(ctx, workload, project, image.Name, log)
+}
+
+// releaseRolloutImage removes the workload from the project of an image without ready pods, unless another
+// ReplicaSet of the workload still runs it
+func (c *Config) releaseRolloutImage(ctx context.Context, workload *Workload, image Image, log *logrus.Entry) error {
+	project, err := c.Client.GetProject(ctx, getProjectName(image.Name), getProjectVersion(image.Name))
+	if err != nil || project == nil {
+		return err
+	}
+	if c.rollouts.running(workload.Key(c.Cluster), project) {
+		return nil
+	}
+	return c.supersedeWorkloadProjects(ctx, []*client.Project{project}, workload, log)
+}
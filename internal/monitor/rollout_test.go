@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func createReplicaSet(name, deployment, image string, ready int32) *appsv1.ReplicaSet {
+	controller := true
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "testns",
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: deployment, Image: image}},
+				},
+			},
+		},
+		Status: appsv1.ReplicaSetStatus{ReadyReplicas: ready},
+	}
+	if deployment != "" {
+		rs.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: deployment, Controller: &controller}}
+	}
+	return rs
+}
+
+func TestReplicaSetWithReadyPodsTagsProject(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+	rs := createReplicaSet("testapp-1", "testapp", "test/nginx:1.0", 1)
+
+	c.On("GetProject", mock.Anything, "test/nginx", "1.0").Return(&client.Project{
+		Uuid:    "v1",
+		Name:    "test/nginx",
+		Version: "1.0",
+		Tags:    []client.Tag{{Name: "workload:test|testns|app|other"}},
+	}, nil).Once()
+	c.On("UpdateProject", mock.Anything, "v1", "test/nginx", "1.0", "", []string{
+		"workload:test|testns|app|other",
+		"workload:test|testns|app|testapp",
+		"team:testns",
+		"env:test",
+	}).Return(nil, nil).Once()
+
+	m.OnReplicaSetAdd(rs)
+	// the images of the ReplicaSet are already tracked
+	m.OnReplicaSetUpdate(rs, rs)
+
+	// ReplicaSets not controlled by a Deployment are ignored
+	m.OnReplicaSetAdd(createReplicaSet("standalone", "", "test/nginx:1.0", 1))
+	c.AssertNumberOfCalls(t, "GetProject", 1)
+}
+
+func TestReplicaSetScaledToZeroReleasesProject(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster)
+	project := func(uuid, version string) *client.Project {
+		return &client.Project{
+			Uuid:    uuid,
+			Name:    "test/nginx",
+			Version: version,
+			Tags:    []client.Tag{{Name: "workload:test|testns|app|testapp"}},
+		}
+	}
+	c.On("GetProject", mock.Anything, "test/nginx", "1.0").Return(project("v1", "1.0"), nil)
+	c.On("GetProject", mock.Anything, "test/nginx", "2.0").Return(project("v2", "2.0"), nil)
+
+	m.OnReplicaSetAdd(createReplicaSet("testapp-1", "testapp", "test/nginx:1.0", 2))
+	m.OnReplicaSetAdd(createReplicaSet("testapp-2", "testapp", "test/nginx:2.0", 1))
+
+	// the new version does not supersede the old one while both serve traffic
+	workload := &Workload{Name: "testapp", Namespace: "testns", Type: "app"}
+	assert.NoError(t, m.supersedeWorkloadProjects(context.Background(), []*client.Project{project("v1", "1.0")}, workload, m.logger))
+	c.AssertNotCalled(t, "DeleteProject", mock.Anything, mock.Anything)
+
+	c.On("DeleteProject", mock.Anything, "v1").Return(nil).Once()
+	m.OnReplicaSetUpdate(nil, createReplicaSet("testapp-1", "testapp", "test/nginx:1.0", 0))
+	c.AssertNumberOfCalls(t, "DeleteProject", 1)
+
+	// the last ReplicaSet with ready pods is left to the events of the scaled down Deployment
+	m.OnReplicaSetDelete(createReplicaSet("testapp-2", "testapp", "test/nginx:2.0", 0))
+	c.AssertNumberOfCalls(t, "DeleteProject", 1)
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/sirupsen/logrus"
+)
+
+// ScaledDownTagPrefix marks the projects of a scaled down workload kept until the grace period has passed, the tag
+// holds the workload and the unix time it was scaled down
+const ScaledDownTagPrefix client.TagPrefix = "scaled-down:"
+
+// WithScaledDownMarker keeps the projects of workloads scaled down to zero replicas, tagging them as scaled down
+// instead of removing the workload from them. The orphan cleanup removes them after a grace period, they are kept
+// as long as it is disabled or runs in dry run.
+func WithScaledDownMarker() Option {
+	return func(c *Config) {
+		c.scaledDownMarker = true
+	}
+}
+
+// ScaledDownTag returns the tag marking the projects of the workload as scaled down at the time
+func (k WorkloadKey) ScaledDownTag(at time.Time) string {
+	return ScaledDownTagPrefix.With(k.scaledDownValue() + strconv.FormatInt(at.Unix(), 10))
+}
+
+func (k WorkloadKey) scaledDownValue() string {
+	return strings.TrimPrefix(k.Tag(), client.WorkloadTagPrefix.String()) + "|"
+}
+
+// ScaledDownSince returns the time the workload of the project was scaled down, false if it is not marked as scaled down
+func ScaledDownSince(project *client.Project, key WorkloadKey) (time.Time, bool) {
+	prefix := ScaledDownTagPrefix.With(key.scaledDownValue())
+	for _, tag := range project.Tags {
+		if !strings.HasPrefix(tag.Name, prefix) {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimPrefix(tag.Name, prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// DeleteScaledDownTag removes the scaled down marker of the workload, it returns whether the project had one
+func (t *Tags) DeleteScaledDownTag(key WorkloadKey) bool {
+	prefix := ScaledDownTagPrefix.With(key.scaledDownValue())
+	other := slices.DeleteFunc(slices.Clone(t.OtherTags), func(tag string) bool {
+		return strings.HasPrefix(tag, prefix)
+	})
+	deleted := len(other) != len(t.OtherTags)
+	t.OtherTags = other
+	return deleted
+}
+
+// markScaledDown tags the projects of the scaled down workload as scaled down, keeping the time of the first scale down
+func (c *Config) markScaledDown(ctx context.Context, projects []*client.Project, workload *Workload, log *logrus.Entry) {
+	key := workload.Key(c.Cluster)
+	now := time.Now()
+	for _, p := range projects {
+		tags := NewTags()
+		tags.ArrangeByPrefix(p.Tags)
+		if !tags.HasWorkload(key.Tag()) {
+			continue
+		}
+		if _, ok := ScaledDownSince(p, key); ok {
+			continue
+		}
+		tags.OtherTags = append(tags.OtherTags, key.ScaledDownTag(now))
+		l := log.WithFields(logrus.Fields{
+			"project":      p.Name,
+			"project-uuid": p.Uuid,
+		})
+		if _, err := c.Client.UpdateProject(ctx, p.Uuid, p.Name, p.Version, p.Group, tags.GetAllTags()); err != nil {
+			l.Warnf("mark project scaled down: %v", err)
+			continue
+		}
+		l.Info("project marked as scaled down")
+	}
+}
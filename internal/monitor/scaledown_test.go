@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestScaledDownWorkloadKeepsProjects(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithScaledDownMarker())
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+	workload.Status.ScaledDown = true
+	key := workload.Key(cluster)
+	scaledDownAt := time.Now().Add(-time.Hour)
+
+	c.On("GetProjectsByTag", mock.Anything, url.QueryEscape(key.Tag())).Return([]*client.Project{
+		{
+			Uuid:    "uuid1",
+			Name:    "test/nginx",
+			Version: "latest",
+			Tags:    []client.Tag{{Name: key.Tag()}, {Name: "team:testns"}, {Name: "env:test"}},
+		},
+		{
+			Uuid:    "uuid2",
+			Name:    "test/nginx",
+			Version: "latest2",
+			Tags:    []client.Tag{{Name: key.Tag()}, {Name: key.ScaledDownTag(scaledDownAt)}},
+		},
+	}, nil)
+	c.On("UpdateProject", mock.Anything, "uuid1", "test/nginx", "latest", "", mock.MatchedBy(func(tags []string) bool {
+		return len(tags) == 4 && slices.Contains(tags, key.Tag()) &&
+			slices.ContainsFunc(tags, func(tag string) bool {
+				return strings.HasPrefix(tag, "scaled-down:test|testns|app|testapp|")
+			})
+	})).Return(nil, nil).Once()
+
+	err := m.verifyWorkloadContainers(context.Background(), workload, m.logger)
+	assert.NoError(t, err)
+	c.AssertNotCalled(t, "DeleteProject", mock.Anything, mock.Anything)
+}
+
+func TestScaledDownSince(t *testing.T) {
+	key := WorkloadKey{Cluster: "test", Namespace: "testns", Type: "app", Name: "testapp"}
+	at := time.Unix(1700000000, 0)
+	project := &client.Project{Tags: []client.Tag{
+		{Name: WorkloadKey{Cluster: "test", Namespace: "testns", Type: "app", Name: "testapp2"}.ScaledDownTag(time.Now())},
+		{Name: key.ScaledDownTag(at)},
+	}}
+
+	since, ok := ScaledDownSince(project, key)
+	assert.True(t, ok)
+	assert.Equal(t, at, since)
+
+	_, ok = ScaledDownSince(project, WorkloadKey{Cluster: "test", Namespace: "testns", Type: "app", Name: "other"})
+	assert.False(t, ok)
+
+	tags := NewTags()
+	tags.ArrangeByPrefix(project.Tags)
+	assert.True(t, tags.DeleteScaledDownTag(key))
+	assert.Len(t, tags.OtherTags, 1)
+}
+
+func TestUpdateExistingProjectTagsClearsScaledDownMarker(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	m := NewMonitor(context.Background(), c, nil, mockattestation.NewVerifier(t), cluster, WithScaledDownMarker())
+	workload := NewWorkload(test.CreateDeployment("testns", "testapp", nil, nil, "test/nginx:latest"))
+	key := workload.Key(cluster)
+
+	project := &client.Project{
+		Uuid:    "uuid1",
+		Name:    "test/nginx",
+		Version: "latest",
+		Tags:    []client.Tag{{Name: key.Tag()}, {Name: "team:testns"}, {Name: "env:test"}, {Name: key.ScaledDownTag(time.Now())}},
+	}
+	c.On("UpdateProject", mock.Anything, "uuid1", "test/nginx", "latest", "", []string{key.Tag(), "team:testns", "env:test"}).
+		Return(nil, nil).Once()
+
+	err := m.updateExistingProjectTags(context.Background(), workload, project, "test/nginx:latest", m.logger)
+	assert.NoError(t, err)
+}
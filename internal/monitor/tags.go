@@ -5,8 +5,25 @@ import (
 	"strings"
 
 	"github.com/nais/dependencytrack/pkg/client"
+
+	"slsa-verde/internal/attestation"
 )
 
+// attestationTagPrefixes are the prefixes of the tags describing the verified attestation of an image
+var attestationTagPrefixes = []client.TagPrefix{
+	client.DigestTagPrefix,
+	client.RekorTagPrefix,
+	client.RekorBuildTriggerTagPrefix,
+	client.RekorOIDCIssuerTagPrefix,
+	client.RekorGitHubWorkflowNameTagPrefix,
+	client.RekorGitHubWorkflowRefTagPrefix,
+	client.RekorGitHubWorkflowSHATagPrefix,
+	client.RekorSourceRepositoryOwnerURITagPrefix,
+	client.RekorBuildConfigURITagPrefix,
+	client.RekorRunInvocationURITagPrefix,
+	client.RekorIntegratedTimeTagPrefix,
+}
+
 type Tags struct {
 	WorkloadTags    []string
 	EnvironmentTags []string
@@ -44,14 +61,58 @@ func (t *Tags) ArrangeByPrefix(tags []client.Tag) {
 }
 
 func (t *Tags) GetImageTag() string {
+	return t.GetTagValue(client.ImageTagPrefix)
+}
+
+// GetTagValue returns the value of the first tag with the given prefix, or an empty string if there is none
+func (t *Tags) GetTagValue(prefix client.TagPrefix) string {
 	for _, tag := range t.OtherTags {
-		if strings.HasPrefix(tag, client.ImageTagPrefix.String()) {
-			return strings.Replace(tag, client.ImageTagPrefix.String(), "", 1)
+		if strings.HasPrefix(tag, prefix.String()) {
+			return strings.Replace(tag, prefix.String(), "", 1)
 		}
 	}
 	return ""
 }
 
+// GetRekorMetadata returns the Rekor metadata the project was tagged with when it was created, nil if it has none
+func (t *Tags) GetRekorMetadata() *attestation.Rekor {
+	if t.GetTagValue(client.RekorTagPrefix) == "" {
+		return nil
+	}
+	return &attestation.Rekor{
+		LogIndex:                 t.GetTagValue(client.RekorTagPrefix),
+		BuildTrigger:             t.GetTagValue(client.RekorBuildTriggerTagPrefix),
+		OIDCIssuer:               t.GetTagValue(client.RekorOIDCIssuerTagPrefix),
+		GitHubWorkflowName:       t.GetTagValue(client.RekorGitHubWorkflowNameTagPrefix),
+		GitHubWorkflowRef:        t.GetTagValue(client.RekorGitHubWorkflowRefTagPrefix),
+		GitHubWorkflowSHA:        t.GetTagValue(client.RekorGitHubWorkflowSHATagPrefix),
+		SourceRepositoryOwnerURI: t.GetTagValue(client.RekorSourceRepositoryOwnerURITagPrefix),
+		BuildConfigURI:           t.GetTagValue(client.RekorBuildConfigURITagPrefix),
+		RunInvocationURI:         t.GetTagValue(client.RekorRunInvocationURITagPrefix),
+		IntegratedTime:           t.GetTagValue(client.RekorIntegratedTimeTagPrefix),
+	}
+}
+
+// SetAttestationTags replaces the tags describing the attestation of the image with the ones of metadata
+func (t *Tags) SetAttestationTags(metadata *attestation.ImageMetadata) {
+	other := make([]string, 0, len(t.OtherTags))
+	for _, tag := range t.OtherTags {
+		if !isAttestationTag(tag) {
+			other = append(other, tag)
+		}
+	}
+	t.OtherTags = append(other, attestationTags(metadata)...)
+}
+
+func isAttestationTag(tag string) bool {
+	for _, prefix := range attestationTagPrefixes {
+		if strings.HasPrefix(tag, prefix.String()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Tags) GetAllTags() []string {
 	var allTags []string
 	allTags = append(allTags, t.WorkloadTags...)
@@ -131,3 +192,28 @@ func containsAllTags(tags []client.Tag, s ...string) bool {
 	}
 	return found == len(s)
 }
+
+// provenanceTagPrefixes are the prefixes of the attestation tags describing the provenance of the image, recorded as
+// project properties instead when enabled. The digest and Rekor log index tags identify the attestation.
+var provenanceTagPrefixes = attestationTagPrefixes[2:]
+
+func isProvenanceTag(tag string) bool {
+	for _, prefix := range provenanceTagPrefixes {
+		if strings.HasPrefix(tag, prefix.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tags) hasProvenanceTags() bool {
+	return slices.ContainsFunc(t.OtherTags, isProvenanceTag)
+}
+
+// deleteProvenanceTags removes the tags describing the provenance of the image, it returns whether there were any
+func (t *Tags) deleteProvenanceTags() bool {
+	other := slices.DeleteFunc(slices.Clone(t.OtherTags), isProvenanceTag)
+	deleted := len(other) != len(t.OtherTags)
+	t.OtherTags = other
+	return deleted
+}
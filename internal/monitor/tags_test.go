@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/nais/dependencytrack/pkg/client"
+
+	"slsa-verde/internal/attestation"
 )
 
 func TestNewTags(t *testing.T) {
@@ -97,3 +99,48 @@ func TestContainsAllTags(t *testing.T) {
 		t.Errorf("ContainsAllTags() = false, want true")
 	}
 }
+
+func TestGetRekorMetadata(t *testing.T) {
+	tags := NewTags()
+	tags.ArrangeByPrefix([]client.Tag{{Name: "digest:123"}})
+	if tags.GetRekorMetadata() != nil {
+		t.Errorf("GetRekorMetadata() = %v, want nil", tags.GetRekorMetadata())
+	}
+
+	clientTags := []client.Tag{{Name: "digest:123"}}
+	for _, tag := range toRekorTags(rekor) {
+		clientTags = append(clientTags, client.Tag{Name: tag})
+	}
+	tags.ArrangeByPrefix(clientTags)
+
+	if got := tags.GetTagValue(client.DigestTagPrefix); got != "123" {
+		t.Errorf("GetTagValue() = %v, want 123", got)
+	}
+	if got := tags.GetRekorMetadata(); *got != *rekor {
+		t.Errorf("GetRekorMetadata() = %v, want %v", got, rekor)
+	}
+}
+
+func TestSetAttestationTags(t *testing.T) {
+	tags := NewTags()
+	tags.ArrangeByPrefix([]client.Tag{
+		{Name: "workload:my-cluster|my-namespace|app|my-app"},
+		{Name: "project:my-app"},
+		{Name: "digest:old"},
+	})
+
+	tags.SetAttestationTags(&attestation.ImageMetadata{Digest: "sha256:123", RekorMetadata: rekor})
+
+	if got := tags.GetTagValue(client.DigestTagPrefix); got != "sha256:123" {
+		t.Errorf("GetTagValue() = %v, want sha256:123", got)
+	}
+	if got := tags.GetRekorMetadata(); *got != *rekor {
+		t.Errorf("GetRekorMetadata() = %v, want %v", got, rekor)
+	}
+	if slices.Contains(tags.GetAllTags(), "digest:old") {
+		t.Errorf("GetAllTags() = %v, want 'digest:old' replaced", tags.GetAllTags())
+	}
+	if !slices.Contains(tags.GetAllTags(), "project:my-app") || !tags.HasWorkload("workload:my-cluster|my-namespace|app|my-app") {
+		t.Errorf("GetAllTags() = %v, want other tags kept", tags.GetAllTags())
+	}
+}
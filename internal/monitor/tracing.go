@@ -0,0 +1,28 @@
+package monitor
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"slsa-verde/internal/observability"
+)
+
+func startSpan(ctx context.Context, name string, workload *Workload, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("workload.name", workload.Name),
+		attribute.String("workload.namespace", workload.Namespace),
+		attribute.String("workload.type", workload.Type),
+	)
+	return observability.Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,8 +1,12 @@
 package monitor
 
 import (
+	"slices"
+	"strings"
+
 	dptrack "github.com/nais/dependencytrack/pkg/client"
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"slsa-verde/internal/attestation"
 	"slsa-verde/internal/observability"
 
@@ -17,6 +21,8 @@ type Workload struct {
 	Images    []Image
 	Status    Status
 	Type      string
+	// Object is the Kubernetes resource of the workload, events are recorded on it
+	Object runtime.Object
 }
 
 type Image struct {
@@ -51,11 +57,15 @@ func NewWorkload(obj any) *Workload {
 			// TODO: an "nais application", and if so, set the type to "app" otherwise to its original type, deployment etc.
 			Type:   "app",
 			Images: images,
+			Object: deployment,
+		}
+
+		if deployment.Spec.Replicas == nil {
+			return workload
 		}
 
 		desiredReplicas := *deployment.Spec.Replicas
-		if deployment.Spec.Replicas != nil &&
-			deployment.Generation == deployment.Status.ObservedGeneration &&
+		if deployment.Generation == deployment.Status.ObservedGeneration &&
 			desiredReplicas == deployment.Status.ReadyReplicas &&
 			desiredReplicas == deployment.Status.AvailableReplicas &&
 			deployment.Status.UnavailableReplicas == 0 {
@@ -71,25 +81,71 @@ func NewWorkload(obj any) *Workload {
 		if err != nil {
 			return nil
 		}
-
-		workload := &Workload{
-			Name:      jobName(job),
-			Namespace: job.GetNamespace(),
-			Type:      "job",
-			Images:    []Image{{Name: job.Spec.Image, ContainerName: jobName(job)}},
-		}
-
-		if job.Status.DeploymentRolloutStatus == "complete" {
-			workload.Status.LastSuccessful = true
-		}
+		workload := newJobWorkload(job)
+		workload.Object = obj
 		return workload
+	case *nais_io_v1.Naisjob:
+		return newJobWorkload(obj)
 	default:
 		return nil
 	}
 }
 
+func newJobWorkload(job *nais_io_v1.Naisjob) *Workload {
+	workload := &Workload{
+		Name:      jobName(job),
+		Namespace: job.GetNamespace(),
+		Type:      "job",
+		Images:    []Image{{Name: job.Spec.Image, ContainerName: jobName(job)}},
+		Object:    job,
+	}
+
+	if job.Status.DeploymentRolloutStatus == "complete" {
+		workload.Status.LastSuccessful = true
+	}
+	return workload
+}
+
+// WorkloadKey identifies a workload in a cluster, it is encoded in the workload tag of projects
+type WorkloadKey struct {
+	Cluster   string
+	Namespace string
+	Type      string
+	Name      string
+}
+
+func (k WorkloadKey) Tag() string {
+	return dptrack.WorkloadTagPrefix.With(k.Cluster + "|" + k.Namespace + "|" + k.Type + "|" + k.Name)
+}
+
+// ParseWorkloadTag parses a tag of the form workload:cluster|namespace|type|name
+func ParseWorkloadTag(tag string) (WorkloadKey, bool) {
+	if !strings.HasPrefix(tag, dptrack.WorkloadTagPrefix.String()) {
+		return WorkloadKey{}, false
+	}
+	parts := strings.Split(strings.TrimPrefix(tag, dptrack.WorkloadTagPrefix.String()), "|")
+	if len(parts) != 4 || slices.Contains(parts, "") {
+		return WorkloadKey{}, false
+	}
+	return WorkloadKey{
+		Cluster:   parts[0],
+		Namespace: parts[1],
+		Type:      parts[2],
+		Name:      parts[3],
+	}, true
+}
+
+func (w *Workload) Key(cluster string) WorkloadKey {
+	return WorkloadKey{
+		Cluster:   cluster,
+		Namespace: w.Namespace,
+		Type:      w.Type,
+		Name:      w.Name,
+	}
+}
+
 func (w *Workload) GetTag(cluster string) string {
-	return dptrack.WorkloadTagPrefix.With(cluster + "|" + w.Namespace + "|" + w.Type + "|" + w.Name)
+	return w.Key(cluster).Tag()
 }
 
 func (w *Workload) initWorkloadTags(metadata *attestation.ImageMetadata, cluster, projectName, projectVersion string) []string {
@@ -97,11 +153,18 @@ func (w *Workload) initWorkloadTags(metadata *attestation.ImageMetadata, cluster
 		dptrack.ProjectTagPrefix.With(projectName),
 		dptrack.ImageTagPrefix.With(metadata.Image),
 		dptrack.VersionTagPrefix.With(projectVersion),
-		dptrack.DigestTagPrefix.With(metadata.Digest),
 		dptrack.EnvironmentTagPrefix.With(cluster),
 		dptrack.TeamTagPrefix.With(w.Namespace),
 		w.GetTag(cluster),
 	}
+	return append(tags, attestationTags(metadata)...)
+}
+
+// attestationTags returns the tags describing the verified attestation of an image
+func attestationTags(metadata *attestation.ImageMetadata) []string {
+	tags := []string{
+		dptrack.DigestTagPrefix.With(metadata.Digest),
+	}
 	if metadata.RekorMetadata != nil {
 		tags = append(tags, dptrack.RekorTagPrefix.With(metadata.RekorMetadata.LogIndex))
 		tags = append(tags, dptrack.RekorBuildTriggerTagPrefix.With(metadata.RekorMetadata.BuildTrigger))
@@ -129,6 +192,24 @@ func (w *Workload) SetVulnerabilityCounter(hasAttestation, image, project string
 	}
 }
 
+func (w *Workload) SetVerificationStatus(image Image, status attestation.Status) {
+	observability.WorkloadVerificationStatus.DeletePartialMatch(prometheus.Labels{
+		"workload_namespace": w.Namespace,
+		"workload":           w.Name,
+		"workload_type":      w.Type,
+		"container":          image.ContainerName,
+	})
+	observability.WorkloadVerificationStatus.WithLabelValues(w.Namespace, w.Name, w.Type, image.ContainerName, image.Name, status.String()).Set(1)
+}
+
+func (w *Workload) DeleteVerificationStatus() {
+	observability.WorkloadVerificationStatus.DeletePartialMatch(prometheus.Labels{
+		"workload_namespace": w.Namespace,
+		"workload":           w.Name,
+		"workload_type":      w.Type,
+	})
+}
+
 func jobName(job *nais_io_v1.Naisjob) string {
 	workloadName := job.Labels["app"]
 	if workloadName != "" {
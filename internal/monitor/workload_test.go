@@ -5,9 +5,11 @@ import (
 	"testing"
 
 	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/observability"
 	"slsa-verde/internal/test"
 
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -150,3 +152,42 @@ func TestJobName(t *testing.T) {
 		t.Errorf("jobName() = %v, want 'my-job'", name)
 	}
 }
+
+func TestSetVerificationStatus(t *testing.T) {
+	observability.WorkloadVerificationStatus.Reset()
+	d := test.CreateDeployment("status-namespace", "status-app", nil, nil, "test/status-app:1.0.0")
+	workload := NewWorkload(d)
+	image := workload.Images[0]
+
+	workload.SetVerificationStatus(image, attestation.StatusUnsigned)
+	assert.Equal(t, float64(1), testutil.ToFloat64(observability.WorkloadVerificationStatus.WithLabelValues("status-namespace", "status-app", "app", "status-app", "test/status-app:1.0.0", "unsigned")))
+
+	workload.SetVerificationStatus(image, attestation.StatusVerified)
+	assert.Equal(t, 1, testutil.CollectAndCount(observability.WorkloadVerificationStatus))
+	assert.Equal(t, float64(1), testutil.ToFloat64(observability.WorkloadVerificationStatus.WithLabelValues("status-namespace", "status-app", "app", "status-app", "test/status-app:1.0.0", "verified")))
+
+	workload.DeleteVerificationStatus()
+	assert.Equal(t, 0, testutil.CollectAndCount(observability.WorkloadVerificationStatus))
+}
+
+func TestParseWorkloadTag(t *testing.T) {
+	for _, tt := range []struct {
+		tag    string
+		want   WorkloadKey
+		wantOk bool
+	}{
+		{tag: "workload:dev|team-a|app|myapp", want: WorkloadKey{Cluster: "dev", Namespace: "team-a", Type: "app", Name: "myapp"}, wantOk: true},
+		{tag: "workload:dev|team-a|myapp"},
+		{tag: "workload:dev|team-a||myapp"},
+		{tag: "team:team-a"},
+	} {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := ParseWorkloadTag(tt.tag)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+			if ok {
+				assert.Equal(t, tt.tag, got.Tag())
+			}
+		})
+	}
+}
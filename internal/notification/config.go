@@ -0,0 +1,110 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"text/template"
+	"time"
+)
+
+type Format string
+
+const (
+	// FormatCloudEvents sends the event as a CloudEvent in HTTP binary content mode
+	FormatCloudEvents Format = "cloudevents"
+	// FormatWebhook sends the event as JSON, or the body rendered from the route template
+	FormatWebhook Format = "webhook"
+)
+
+type Config struct {
+	Routes []Route `json:"routes"`
+	// MaxAttempts is the number of times a delivery is attempted before it is dropped
+	MaxAttempts int `json:"maxAttempts"`
+	// Backoff is the wait before the first retry, doubled for each retry
+	Backoff Duration `json:"backoff"`
+}
+
+// Route sends the events matching its namespaces and event types to a URL.
+type Route struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Format defaults to cloudevents
+	Format Format `json:"format"`
+	// Namespaces the route applies to, all namespaces if empty
+	Namespaces []string `json:"namespaces"`
+	// Events the route applies to, all events if empty
+	Events []Type `json:"events"`
+	// Template of the webhook body, executed with the Event
+	Template string            `json:"template"`
+	Headers  map[string]string `json:"headers"`
+
+	tmpl *template.Template
+}
+
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read notification config: %w", err)
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parse notification config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (r *Route) init() error {
+	if r.URL == "" {
+		return fmt.Errorf("route %q: url is required", r.Name)
+	}
+	if r.Name == "" {
+		r.Name = r.URL
+	}
+
+	switch r.Format {
+	case "":
+		r.Format = FormatCloudEvents
+	case FormatCloudEvents:
+	case FormatWebhook:
+		if r.Template == "" {
+			return nil
+		}
+		tmpl, err := template.New(r.Name).Parse(r.Template)
+		if err != nil {
+			return fmt.Errorf("route %q: parse template: %w", r.Name, err)
+		}
+		r.tmpl = tmpl
+	default:
+		return fmt.Errorf("route %q: unknown format %q", r.Name, r.Format)
+	}
+	return nil
+}
+
+func (r *Route) matches(e Event) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, e.Namespace) {
+		return false
+	}
+	if len(r.Events) > 0 && !slices.Contains(r.Events, e.Type) {
+		return false
+	}
+	return true
+}
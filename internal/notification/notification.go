@@ -0,0 +1,234 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/observability"
+)
+
+// Type is the type of event, used as the CloudEvents type
+type Type string
+
+const (
+	TypeWorkloadUnattested               Type = "io.nais.slsa-verde.workload.unattested"
+	TypeVerificationFailed               Type = "io.nais.slsa-verde.verification.failed"
+	TypeProjectCreated                   Type = "io.nais.slsa-verde.project.created"
+	TypeProjectDeleted                   Type = "io.nais.slsa-verde.project.deleted"
+	TypeCriticalVulnerabilitiesIncreased Type = "io.nais.slsa-verde.vulnerabilities.critical.increased"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	queueSize          = 1000
+	workers            = 4
+)
+
+type Event struct {
+	Type             Type      `json:"type"`
+	Time             time.Time `json:"time"`
+	Cluster          string    `json:"cluster"`
+	Namespace        string    `json:"namespace"`
+	Workload         string    `json:"workload,omitempty"`
+	WorkloadType     string    `json:"workloadType,omitempty"`
+	Container        string    `json:"container,omitempty"`
+	Image            string    `json:"image,omitempty"`
+	Digest           string    `json:"digest,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	Message          string    `json:"message,omitempty"`
+	Project          string    `json:"project,omitempty"`
+	ProjectUuid      string    `json:"projectUuid,omitempty"`
+	Critical         int       `json:"critical,omitempty"`
+	PreviousCritical int       `json:"previousCritical,omitempty"`
+}
+
+// Subject identifies the workload, or the project if the event is not about a workload
+func (e Event) Subject() string {
+	if e.Workload == "" {
+		return e.Project
+	}
+	return e.Namespace + "/" + e.Workload
+}
+
+type delivery struct {
+	route *Route
+	event Event
+}
+
+// Notifier delivers events to the routes matching them, retrying failed deliveries in the background.
+type Notifier struct {
+	routes      []*Route
+	source      string
+	client      *http.Client
+	queue       chan delivery
+	maxAttempts int
+	backoff     time.Duration
+	logger      *log.Entry
+}
+
+// New returns a notifier for the routes in cfg, source identifies this instance in the CloudEvents source attribute
+func New(cfg *Config, source string) (*Notifier, error) {
+	routes := make([]*Route, 0, len(cfg.Routes))
+	for i := range cfg.Routes {
+		r := cfg.Routes[i]
+		if err := r.init(); err != nil {
+			return nil, err
+		}
+		routes = append(routes, &r)
+	}
+
+	n := &Notifier{
+		routes:      routes,
+		source:      source,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan delivery, queueSize),
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff.Duration,
+		logger:      log.WithField("package", "notification"),
+	}
+	if n.maxAttempts <= 0 {
+		n.maxAttempts = defaultMaxAttempts
+	}
+	if n.backoff <= 0 {
+		n.backoff = defaultBackoff
+	}
+	return n, nil
+}
+
+// Notify queues the event for the matching routes, it does not block and drops the event if the queue is full
+func (n *Notifier) Notify(_ context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, r := range n.routes {
+		if !r.matches(e) {
+			continue
+		}
+		select {
+		case n.queue <- delivery{route: r, event: e}:
+		default:
+			observability.NotificationsSent.WithLabelValues(string(e.Type), r.Name, "dropped").Inc()
+			n.logger.WithField("route", r.Name).Warnf("notification queue full, dropping %s event", e.Type)
+		}
+	}
+}
+
+// Run delivers queued events until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-n.queue:
+					n.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, d delivery) {
+	l := n.logger.WithFields(log.Fields{
+		"route": d.route.Name,
+		"type":  d.event.Type,
+	})
+
+	backoff := n.backoff
+	var err error
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		var retry bool
+		retry, err = n.send(ctx, d.route, d.event)
+		if err == nil {
+			observability.NotificationsSent.WithLabelValues(string(d.event.Type), d.route.Name, "delivered").Inc()
+			return
+		}
+		if !retry || attempt == n.maxAttempts {
+			break
+		}
+
+		l.Debugf("attempt %d: %v, retrying in %s", attempt, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	observability.NotificationsSent.WithLabelValues(string(d.event.Type), d.route.Name, "failed").Inc()
+	l.Warnf("deliver notification: %v", err)
+}
+
+// send delivers the event once, reporting whether a failed delivery can be retried
+func (n *Notifier) send(ctx context.Context, r *Route, e Event) (bool, error) {
+	req, err := n.request(ctx, r, e)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+func (n *Notifier) request(ctx context.Context, r *Route, e Event) (*http.Request, error) {
+	var body bytes.Buffer
+	if r.tmpl != nil {
+		if err := r.tmpl.Execute(&body, e); err != nil {
+			return nil, fmt.Errorf("execute template: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(e); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if r.Format == FormatCloudEvents {
+		req.Header.Set("ce-specversion", "1.0")
+		req.Header.Set("ce-id", newID())
+		req.Header.Set("ce-source", n.source)
+		req.Header.Set("ce-type", string(e.Type))
+		req.Header.Set("ce-subject", e.Subject())
+		req.Header.Set("ce-time", e.Time.UTC().Format(time.RFC3339Nano))
+	}
+	return req, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,117 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func TestNotifier(t *testing.T) {
+	requests := make(chan request, 10)
+	var failures atomic.Int32
+	failures.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: string(body)}
+	}))
+	defer server.Close()
+
+	n, err := New(&Config{
+		Backoff: Duration{time.Millisecond},
+		Routes: []Route{
+			{Name: "events", URL: server.URL + "/flaky", Namespaces: []string{"team-a"}},
+			{
+				Name:     "chat",
+				URL:      server.URL + "/chat",
+				Format:   FormatWebhook,
+				Events:   []Type{TypeWorkloadUnattested},
+				Template: `{"text": "{{ .Workload }} in {{ .Namespace }} is not attested"}`,
+			},
+		},
+	}, "slsa-verde/test")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	event := Event{
+		Type:      TypeWorkloadUnattested,
+		Time:      time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC),
+		Cluster:   "test",
+		Namespace: "team-a",
+		Workload:  "app1",
+	}
+
+	t.Run("should send cloudevent after retrying and templated webhook", func(t *testing.T) {
+		n.Notify(ctx, event)
+
+		got := map[string]request{}
+		for range 2 {
+			select {
+			case r := <-requests:
+				got[r.header.Get("ce-type")] = r
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for notifications")
+			}
+		}
+
+		webhook := got[""]
+		assert.JSONEq(t, `{"text": "app1 in team-a is not attested"}`, webhook.body)
+
+		cloudEvent := got[string(TypeWorkloadUnattested)]
+		assert.Equal(t, "1.0", cloudEvent.header.Get("ce-specversion"))
+		assert.Equal(t, "slsa-verde/test", cloudEvent.header.Get("ce-source"))
+		assert.Equal(t, "team-a/app1", cloudEvent.header.Get("ce-subject"))
+		assert.Equal(t, "2025-05-01T12:00:00Z", cloudEvent.header.Get("ce-time"))
+		assert.NotEmpty(t, cloudEvent.header.Get("ce-id"))
+
+		var data Event
+		assert.NoError(t, json.Unmarshal([]byte(cloudEvent.body), &data))
+		assert.Equal(t, event, data)
+	})
+
+	t.Run("should route by namespace and event type", func(t *testing.T) {
+		event.Namespace = "team-b"
+		event.Type = TypeVerificationFailed
+		n.Notify(ctx, event)
+
+		select {
+		case r := <-requests:
+			t.Fatalf("unexpected notification: %v", r)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestNewValidatesRoutes(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		route Route
+	}{
+		{name: "missing url", route: Route{Name: "r"}},
+		{name: "unknown format", route: Route{URL: "http://localhost", Format: "xml"}},
+		{name: "invalid template", route: Route{URL: "http://localhost", Format: FormatWebhook, Template: "{{ .Workload"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&Config{Routes: []Route{tt.route}}, "slsa-verde/test")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -28,8 +28,163 @@ var WorkloadWithAttestationCritical = prometheus.NewGaugeVec(
 	[]string{"workload_namespace", "workload", "workload_type", "project"},
 )
 
+var WorkloadVerificationStatus = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "slsa_workload_verification_status",
+		Help: "Outcome of the last image verification of a workload container",
+	},
+	[]string{"workload_namespace", "workload", "workload_type", "container", "image", "status"},
+)
+
+var VerificationDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "slsa_verification_duration_seconds",
+		Help:    "Time spent verifying image attestations",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	},
+	[]string{"outcome"},
+)
+
+var RegistryRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "slsa_registry_request_duration_seconds",
+		Help:    "Time spent on requests to container registries",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"host", "outcome"},
+)
+
+var RekorMetadataParsed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_rekor_metadata_parsed_total",
+		Help: "Number of Rekor bundles parsed for metadata",
+	},
+	[]string{"outcome"},
+)
+
+var SbomStoreRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "slsa_sbom_store_request_duration_seconds",
+		Help:    "Time spent on requests to the SBOM store (Dependency-Track)",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"operation", "outcome"},
+)
+
+var VulnerabilitiesRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "slsa_vulnerabilities_request_duration_seconds",
+		Help:    "Time spent on requests to the vulnerabilities API (v13s)",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"operation", "outcome"},
+)
+
+var InformerEvents = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_informer_events_total",
+		Help: "Number of informer events handled",
+	},
+	[]string{"event", "workload_type"},
+)
+
+var NotificationsSent = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_notifications_total",
+		Help: "Number of notifications by event type and outcome of the delivery",
+	},
+	[]string{"type", "route", "outcome"},
+)
+
+var OrphanRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_orphan_runs_total",
+		Help: "Number of orphan cleanup runs by outcome",
+	},
+	[]string{"outcome"},
+)
+
+var OrphanActions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_orphan_actions_total",
+		Help: "Number of actions planned by orphan cleanup runs by type and outcome",
+	},
+	[]string{"type", "outcome"},
+)
+
+var OrphanLastRun = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "slsa_orphan_last_run_timestamp_seconds",
+		Help: "Time the last orphan cleanup run finished",
+	},
+)
+
+var OutboxDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "slsa_outbox_depth",
+		Help: "Number of pending writes to the SBOM store and the vulnerabilities API in the outbox",
+	},
+	[]string{"kind"},
+)
+
+var OutboxReplays = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_outbox_replays_total",
+		Help: "Number of replays of pending writes in the outbox by outcome",
+	},
+	[]string{"kind", "outcome"},
+)
+
+var CircuitBreakerState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "slsa_circuit_breaker_state",
+		Help: "State of the circuit breaker of a backend, 0 closed, 1 half-open and 2 open",
+	},
+	[]string{"backend"},
+)
+
+var CircuitBreakerRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_circuit_breaker_rejected_total",
+		Help: "Number of calls to a backend failed fast by its open circuit breaker",
+	},
+	[]string{"backend"},
+)
+
+var ProjectIndexRequestsSaved = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slsa_project_index_requests_saved_total",
+		Help: "Number of Dependency-Track requests answered from the project index instead",
+	},
+	[]string{"call"},
+)
+
+var ProjectIndexProjects = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "slsa_project_index_projects",
+		Help: "Number of projects in the project index",
+	},
+)
+
 func init() {
 	prometheus.MustRegister(WorkloadWithAttestation)
 	prometheus.MustRegister(WorkloadWithAttestationRiskScore)
 	prometheus.MustRegister(WorkloadWithAttestationCritical)
+	prometheus.MustRegister(WorkloadVerificationStatus)
+	prometheus.MustRegister(VerificationDuration)
+	prometheus.MustRegister(RegistryRequestDuration)
+	prometheus.MustRegister(RekorMetadataParsed)
+	prometheus.MustRegister(SbomStoreRequestDuration)
+	prometheus.MustRegister(VulnerabilitiesRequestDuration)
+	prometheus.MustRegister(InformerEvents)
+	prometheus.MustRegister(NotificationsSent)
+	prometheus.MustRegister(OrphanRuns)
+	prometheus.MustRegister(OrphanActions)
+	prometheus.MustRegister(OrphanLastRun)
+	prometheus.MustRegister(OutboxDepth)
+	prometheus.MustRegister(OutboxReplays)
+	prometheus.MustRegister(CircuitBreakerState)
+	prometheus.MustRegister(CircuitBreakerRejected)
+	prometheus.MustRegister(ProjectIndexRequestsSaved)
+	prometheus.MustRegister(ProjectIndexProjects)
 }
@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "slsa-verde"
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupTracing exports spans with OTLP over gRPC to the given endpoint, the exporter
+// is configured further by the standard OTEL_EXPORTER_OTLP_* environment variables.
+func SetupTracing(ctx context.Context, endpoint, serviceName string) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// TraceHook adds the trace and span id to log entries created with a context holding a span
+type TraceHook struct{}
+
+func (h *TraceHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *TraceHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	spanContext := trace.SpanContextFromContext(entry.Context)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = spanContext.TraceID().String()
+	entry.Data["span_id"] = spanContext.SpanID().String()
+	return nil
+}
@@ -0,0 +1,31 @@
+package observability
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTraceHook(t *testing.T) {
+	hook := &TraceHook{}
+
+	t.Run("should add trace and span id to entries with a span in the context", func(t *testing.T) {
+		provider := sdktrace.NewTracerProvider()
+		ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+		defer span.End()
+
+		entry := log.WithContext(ctx)
+		assert.NoError(t, hook.Fire(entry))
+		assert.Equal(t, span.SpanContext().TraceID().String(), entry.Data["trace_id"])
+		assert.Equal(t, span.SpanContext().SpanID().String(), entry.Data["span_id"])
+	})
+
+	t.Run("should ignore entries without a span", func(t *testing.T) {
+		entry := log.WithContext(context.Background())
+		assert.NoError(t, hook.Fire(entry))
+		assert.NotContains(t, entry.Data, "trace_id")
+	})
+}
@@ -0,0 +1,93 @@
+package orphan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"slsa-verde/internal/observability"
+)
+
+// Collector runs the orphan cleanup periodically, keeping the report of the last run.
+type Collector struct {
+	props    *Properties
+	interval time.Duration
+	dryRun   bool
+
+	mu      sync.RWMutex
+	last    *Report
+	lastErr error
+}
+
+func NewCollector(props *Properties, interval time.Duration, dryRun bool) *Collector {
+	return &Collector{
+		props:    props,
+		interval: interval,
+		dryRun:   dryRun,
+	}
+}
+
+// Run runs the cleanup right away and then every interval until ctx is done
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.collect()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) collect() {
+	report, err := c.props.Run(c.dryRun)
+	if err != nil {
+		c.props.log.Errorf("orphan cleanup: %v", err)
+	}
+
+	outcome := "success"
+	switch {
+	case errors.Is(err, ErrBudgetExceeded):
+		outcome = "aborted"
+	case err != nil:
+		outcome = "error"
+	}
+	observability.OrphanRuns.WithLabelValues(outcome).Inc()
+	observability.OrphanLastRun.SetToCurrentTime()
+	for _, a := range report.Actions {
+		observability.OrphanActions.WithLabelValues(string(a.Type), a.outcome()).Inc()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = report
+	c.lastErr = err
+}
+
+// ServeHTTP serves the report of the last run as JSON, 404 if there has been no run yet
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	c.mu.RLock()
+	report, err := c.last, c.lastErr
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "orphan cleanup has not run yet"})
+		return
+	}
+
+	resp := struct {
+		*Report
+		Error string `json:"error,omitempty"`
+	}{Report: report}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
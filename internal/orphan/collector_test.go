@@ -0,0 +1,99 @@
+package orphan
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"slsa-verde/internal/monitor"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+type fakeLister []*monitor.Workload
+
+func (l fakeLister) ListWorkloads(context.Context) ([]*monitor.Workload, error) {
+	return l, nil
+}
+
+func TestCollector(t *testing.T) {
+	mockClient := mockmonitor.NewClient(t)
+	lister := fakeLister{monitor.NewWorkload(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "team-a"},
+	})}
+	props := NewWithLister(context.Background(), mockClient, lister, "test-cluster", log.WithField("system", "test"))
+	collector := NewCollector(props, time.Hour, true)
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orphan", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			{Uuid: "running", Tags: []client.Tag{{Name: "workload:test-cluster|team-a|app|myapp"}, {Name: "rekor:1"}, {Name: "digest:sha256:1"}}},
+			{Uuid: "gone", Tags: []client.Tag{{Name: "workload:test-cluster|team-a|app|gone"}}},
+		}, nil)
+	collector.collect()
+
+	rec = httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orphan", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var report Report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Workloads)
+	assert.Equal(t, 2, report.Projects)
+	if !assert.Len(t, report.Actions, 1) {
+		return
+	}
+	assert.Equal(t, "gone", report.Actions[0].ProjectUuid)
+	assert.False(t, report.Actions[0].Executed)
+	assert.False(t, report.FinishedAt.IsZero())
+	mockClient.AssertNotCalled(t, "DeleteProject", mock.Anything, mock.Anything)
+}
+
+func TestRunRestrictedToNamespace(t *testing.T) {
+	mockClient := mockmonitor.NewClient(t)
+	props := NewWithLister(context.Background(), mockClient, fakeLister{}, "test-cluster", log.WithField("system", "test"))
+	props.Namespace = "team-a"
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			{Uuid: "team-a", Tags: []client.Tag{{Name: "workload:test-cluster|team-a|app|gone"}}},
+			{Uuid: "team-b", Tags: []client.Tag{{Name: "workload:test-cluster|team-b|app|myapp"}}},
+		}, nil)
+	mockClient.On("DeleteProject", mock.Anything, "team-a").Return(nil)
+
+	report, err := props.Run(false)
+	assert.NoError(t, err)
+	if !assert.Len(t, report.Actions, 1) {
+		return
+	}
+	assert.Equal(t, "team-a", report.Actions[0].ProjectUuid)
+	mockClient.AssertNotCalled(t, "DeleteProject", mock.Anything, "team-b")
+}
+
+func TestCollectorRunsRightAway(t *testing.T) {
+	mockClient := mockmonitor.NewClient(t)
+	props := NewWithLister(context.Background(), mockClient, fakeLister{}, "test-cluster", log.WithField("system", "test"))
+	collector := NewCollector(props, 24*time.Hour, true)
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").Return([]*client.Project{}, nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	collector.Run(ctx)
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orphan", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -2,192 +2,371 @@ package orphan
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/nais/dependencytrack/pkg/client"
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/nais/v13s/pkg/api/vulnerabilities"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	k8s "sigs.k8s.io/controller-runtime/pkg/client"
+	"slsa-verde/internal/attestation"
 	"slsa-verde/internal/monitor"
 	"slsa-verde/internal/observability"
+	"slsa-verde/internal/sbomstore"
 )
 
-type Properties struct {
-	ctx       context.Context
-	dpClient  client.Client
-	k8sClient k8s.Client
-	Cluster   string
-	log       *log.Entry
+// WorkloadLister lists the workloads existing in the cluster
+type WorkloadLister interface {
+	ListWorkloads(ctx context.Context) ([]*monitor.Workload, error)
 }
 
-type K8sData struct {
-	WorkloadName string
-	Namespace    string
+type Properties struct {
+	ctx      context.Context
+	dpClient client.Client
+	lister   WorkloadLister
+	Cluster  string
+	// Namespace restricts the run to the projects of workloads in the namespace, empty for all namespaces
+	Namespace string
+	// Budget aborts a run planning to delete more projects than allowed
+	Budget Budget
+	// Verifier re-verifies the images of projects missing attestation tags whose workloads still exist,
+	// backfilling the tags instead of deleting the projects. Nil deletes them.
+	Verifier attestation.Verifier
+	// VulnerabilitiesClient marks the workloads that are gone as deleted in v13s, nil skips it.
+	// Only the workloads of the projects cleaned up are marked: the pinned v13s API offers RegisterWorkload
+	// but no call listing the registrations of a cluster, registrations of workloads without a project are
+	// not reconciled until it does.
+	VulnerabilitiesClient vulnerabilities.Client
+	// Retention of the projects of previous versions of workloads, superseded projects beyond it are pruned
+	Retention monitor.Retention
+	// ScaledDownGracePeriod removes workloads marked as scaled down for longer than this from their projects like
+	// workloads that are gone, 0 keeps them
+	ScaledDownGracePeriod time.Duration
+	log                   *log.Entry
 }
 
-type ProjectData struct {
-	WorkloadTag string
-	Project     *client.Project
+func New(ctx context.Context, dpClient client.Client, k8sClient k8s.Client, cluster string, log *log.Entry) *Properties {
+	return NewWithLister(ctx, dpClient, &clientLister{client: k8sClient, log: log}, cluster, log)
 }
 
-func New(ctx context.Context, dpClient client.Client, k8sClient k8s.Client, cluster string, log *log.Entry) *Properties {
+// NewWithLister returns Properties taking the existing workloads from lister, e.g. informer caches
+func NewWithLister(ctx context.Context, dpClient client.Client, lister WorkloadLister, cluster string, log *log.Entry) *Properties {
 	return &Properties{
-		ctx:       ctx,
-		dpClient:  dpClient,
-		k8sClient: k8sClient,
-		Cluster:   cluster,
-		log:       log,
+		ctx:      ctx,
+		dpClient: sbomstore.Wrap(dpClient),
+		lister:   lister,
+		Cluster:  cluster,
+		log:      log,
 	}
 }
 
-func (p *Properties) TidyWorkloadProject(project *client.Project, workloadTag string, dryRun bool) error {
-	var err error
-	tags := monitor.NewTags()
-	tags.ArrangeByPrefix(project.Tags)
-	image := tags.GetImageTag()
-	attest := monitor.HasAttestation(project)
-
-	l := p.log.WithFields(log.Fields{
-		"image":           image,
-		"has-attestation": attest,
-		"workload-tag":    workloadTag,
-		"cluster":         p.Cluster,
-	})
-
-	if len(strings.Split(workloadTag, "|")) < 4 {
-		l.Warn("workload tag does not contain all required fields: ", workloadTag)
-		return nil
+func (p *Properties) Run(dryRun bool) (*Report, error) {
+	report := &Report{
+		Cluster:   p.Cluster,
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Actions:   make([]*Action, 0),
 	}
+	defer func() { report.FinishedAt = time.Now() }()
 
-	workloadName := strings.Split(workloadTag, "|")[3]
-	workloadType := strings.Split(workloadTag, "|")[2]
-	workloadNamespace := strings.Split(workloadTag, "|")[1]
+	workloads, err := p.lister.ListWorkloads(p.ctx)
+	if err != nil {
+		return report, err
+	}
 
-	if monitor.IsThisWorkload(tags, workloadTag) {
-		if dryRun {
-			l.Infoln("Dry run: skipping project deletion:", project.Name)
-			return nil
-		}
-		if err = p.dpClient.DeleteProject(p.ctx, project.Uuid); err != nil {
-			return fmt.Errorf("error deleting project: %v", err)
+	// Create a set of the workloads keyed like the workload tags of the projects
+	k8sWorkloads := make(map[monitor.WorkloadKey]struct{})
+	for _, w := range workloads {
+		k8sWorkloads[w.Key(p.Cluster)] = struct{}{}
+	}
+	report.Workloads = len(k8sWorkloads)
+
+	p.log.Infoln("Kubernetes workloads found:", len(k8sWorkloads))
+	projectList, err := p.dpClient.GetProjectsByTag(p.ctx, client.EnvironmentTagPrefix.With(p.Cluster))
+	if err != nil {
+		return report, fmt.Errorf("error fetching projects: %v", err)
+	}
+	report.Projects = len(projectList)
+
+	p.log.Infoln("DependencyTrack projects found:", len(projectList))
+	report.Actions = p.plan(projectList, k8sWorkloads)
+	for _, a := range report.Actions {
+		if a.isDeletion() {
+			report.Deletions++
 		}
-		l.Info("project deleted:", project.Name)
-		observability.WorkloadWithAttestation.DeleteLabelValues(workloadNamespace, workloadName, workloadType, strconv.FormatBool(attest), image)
-	} else if tags.HasWorkload(workloadTag) {
+	}
+	p.log.Infoln("Actions planned:", len(report.Actions), "deletions:", report.Deletions)
+
+	if err = p.Budget.check(report.Deletions, report.Projects); err != nil {
+		report.Aborted = true
+		report.AbortReason = err.Error()
+		return report, err
+	}
+
+	for _, a := range report.Actions {
+		l := p.log.WithFields(log.Fields{
+			"action":       a.Type,
+			"project":      a.ProjectName,
+			"project-uuid": a.ProjectUuid,
+			"reason":       a.Reason,
+		})
 		if dryRun {
-			l.Infoln("Dry run: skipping tags removal:", project.Name)
-			return nil
+			l.Info("Dry run: skipping action")
+			continue
 		}
-		tags.DeleteWorkloadTag(workloadTag)
-		_, err = p.dpClient.UpdateProject(p.ctx, project.Uuid, project.Name, project.Version, project.Group, tags.GetAllTags())
-		if err != nil {
-			return fmt.Errorf("error updating project: %v", err)
+		if err := p.execute(a); err != nil {
+			a.Error = err.Error()
+			l.Errorf("Error executing action: %v", err)
+			continue
 		}
-		l.Info("project tags removed:", project.Name)
-		observability.WorkloadWithAttestation.DeleteLabelValues(workloadNamespace, workloadName, workloadType, strconv.FormatBool(attest), image)
+		a.Executed = true
+		l.Info("action executed")
 	}
-	return err
+	return report, nil
 }
 
-func (p *Properties) Run(dryRun bool) error {
-	var deploymentList appsv1.DeploymentList
-	err := p.k8sClient.List(p.ctx, &deploymentList)
-	if err != nil {
-		return fmt.Errorf("error listing deployments: %v", err)
+// plan returns the actions needed to remove the workloads that are gone from the projects
+func (p *Properties) plan(projects []*client.Project, k8sWorkloads map[monitor.WorkloadKey]struct{}) []*Action {
+	actions := make([]*Action, 0)
+	expired := make(map[string]bool)
+	for _, project := range p.Retention.Expired(projects, time.Now()) {
+		expired[project.Uuid] = true
 	}
+	var numberofWorkloads int
+	for _, project := range projects {
+		if monitor.IsHierarchyProject(project) {
+			// parent projects of teams and applications have no workloads nor attestations
+			continue
+		}
+		tags := monitor.NewTags()
+		tags.ArrangeByPrefix(project.Tags)
 
-	var jobList nais_io_v1.NaisjobList
-	listJobs := true
-	if err = p.k8sClient.List(p.ctx, &jobList); err != nil {
-		if err.Error() == "no matches for kind \"Naisjob\" in version \"nais.io/v1\"" {
-			p.log.Println("Naisjob custom resource definition not found")
-			listJobs = false
-		} else {
-			return fmt.Errorf("error listing jobs: %v", err)
+		if key, _, ok := monitor.Superseded(project); ok && len(tags.WorkloadTags) == 0 {
+			if action := p.planSuperseded(project, key, k8sWorkloads, expired[project.Uuid]); action != nil {
+				actions = append(actions, action)
+			}
+			continue
 		}
+
+		var orphaned, dormant []string
+		var existing int
+		for _, tag := range tags.WorkloadTags {
+			key, ok := monitor.ParseWorkloadTag(tag)
+			if !ok || key.Cluster != p.Cluster || (p.Namespace != "" && key.Namespace != p.Namespace) {
+				continue
+			}
+			numberofWorkloads++
+			if _, ok := k8sWorkloads[key]; !ok {
+				p.log.Debug("Workload not found in Kubernetes: ", tag)
+				orphaned = append(orphaned, tag)
+				continue
+			}
+			if p.scaledDownExpired(project, key) {
+				p.log.Debug("Workload scaled down longer than the grace period: ", tag)
+				orphaned = append(orphaned, tag)
+				dormant = append(dormant, tag)
+				continue
+			}
+			existing++
+		}
+		if p.Namespace != "" && len(orphaned)+existing == 0 {
+			// project of workloads in other namespaces
+			continue
+		}
+
+		action := &Action{
+			ProjectUuid:         project.Uuid,
+			ProjectName:         project.Name,
+			ProjectVersion:      project.Version,
+			WorkloadTags:        orphaned,
+			DormantWorkloadTags: dormant,
+			project:             project,
+		}
+		switch {
+		case len(orphaned) > 0 && len(orphaned) == len(tags.WorkloadTags):
+			action.Type = ActionDeleteProject
+			action.Reason = "no workload using the project exists"
+			if len(dormant) > 0 {
+				action.Reason = "no workload using the project exists or has been scaled up within the grace period"
+			}
+		case len(orphaned) > 0:
+			action.Type = ActionRemoveWorkloadTags
+			action.Reason = "workloads no longer exist, project is still used by other workloads"
+			if len(dormant) > 0 {
+				action.Reason = "workloads no longer exist or are scaled down longer than the grace period, project is still used by other workloads"
+			}
+		case !tagsContainsAllPrefixes(project.Tags, "rekor", "digest") && p.Verifier != nil && existing > 0:
+			action.Type = ActionBackfillProject
+			action.Image = projectImage(project, tags)
+			action.Reason = "project is missing rekor or digest tags, its workloads still exist"
+		case !tagsContainsAllPrefixes(project.Tags, "rekor", "digest"):
+			action.Type = ActionDeleteUntaggedProject
+			action.Reason = "project is missing rekor or digest tags"
+			if p.Verifier != nil {
+				action.Reason = "project is missing rekor or digest tags, no workload using the project exists"
+			}
+		default:
+			continue
+		}
+		actions = append(actions, action)
 	}
+	p.log.Infoln("Number of workloads found:", numberofWorkloads)
+	return actions
+}
 
-	if listJobs {
-		err = p.k8sClient.List(p.ctx, &jobList)
+// scaledDownExpired returns whether the workload of the project has been scaled down for longer than the grace period
+func (p *Properties) scaledDownExpired(project *client.Project, key monitor.WorkloadKey) bool {
+	if p.ScaledDownGracePeriod <= 0 {
+		return false
+	}
+	since, ok := monitor.ScaledDownSince(project, key)
+	return ok && time.Since(since) > p.ScaledDownGracePeriod
+}
+
+// planSuperseded returns the pruning of a superseded project whose workload is gone or that is beyond the retention,
+// nil if it is kept
+func (p *Properties) planSuperseded(project *client.Project, key monitor.WorkloadKey, k8sWorkloads map[monitor.WorkloadKey]struct{}, expired bool) *Action {
+	if key.Cluster != p.Cluster || (p.Namespace != "" && key.Namespace != p.Namespace) {
+		return nil
+	}
+	action := &Action{
+		Type:           ActionPruneSupersededProject,
+		ProjectUuid:    project.Uuid,
+		ProjectName:    project.Name,
+		ProjectVersion: project.Version,
+		project:        project,
+	}
+	if _, ok := k8sWorkloads[key]; !ok {
+		action.Reason = "workload of the superseded project no longer exists"
+		return action
+	}
+	if expired {
+		action.Reason = "superseded project is beyond the retention"
+		return action
+	}
+	return nil
+}
+
+func (p *Properties) execute(a *Action) error {
+	switch a.Type {
+	case ActionDeleteProject, ActionDeleteUntaggedProject, ActionPruneSupersededProject:
+		if err := p.dpClient.DeleteProject(p.ctx, a.ProjectUuid); err != nil {
+			return fmt.Errorf("error deleting project: %v", err)
+		}
+	case ActionRemoveWorkloadTags:
+		tags := monitor.NewTags()
+		tags.ArrangeByPrefix(a.project.Tags)
+		for _, tag := range a.WorkloadTags {
+			tags.DeleteWorkloadTag(tag)
+			if key, ok := monitor.ParseWorkloadTag(tag); ok {
+				tags.DeleteScaledDownTag(key)
+			}
+		}
+		_, err := p.dpClient.UpdateProject(p.ctx, a.ProjectUuid, a.ProjectName, a.ProjectVersion, a.project.Group, tags.GetAllTags())
 		if err != nil {
-			return fmt.Errorf("error listing jobs: %v", err)
+			return fmt.Errorf("error updating project: %v", err)
 		}
+	case ActionBackfillProject:
+		return p.backfill(a)
 	}
 
-	// Create a map of workloads and their images
-	k8sWorkloads := make(map[string]*K8sData) // Map workload name to image
-	for _, item := range deploymentList.Items {
-		k8sWorkloads[item.Name] = &K8sData{
-			WorkloadName: item.GetName(),
-			Namespace:    item.GetNamespace(),
+	for _, tag := range a.WorkloadTags {
+		key, _ := monitor.ParseWorkloadTag(tag)
+		observability.WorkloadWithAttestation.DeletePartialMatch(prometheus.Labels{
+			"workload_namespace": key.Namespace,
+			"workload":           key.Name,
+			"workload_type":      key.Type,
+		})
+		if slices.Contains(a.DormantWorkloadTags, tag) || p.VulnerabilitiesClient == nil {
+			// scaled down workloads still exist and are marked as such
+			continue
 		}
-	}
-	for _, item := range jobList.Items {
-		k8sWorkloads[item.Name] = &K8sData{
-			WorkloadName: item.GetName(),
-			Namespace:    item.GetNamespace(),
+		if err := monitor.MarkWorkload(p.ctx, p.VulnerabilitiesClient, key, a.project, monitor.WorkloadStateDeleted); err != nil {
+			p.log.WithField("workload-tag", tag).Warnf("mark workload deleted in v13s: %v", err)
 		}
 	}
+	return nil
+}
 
-	p.log.Infoln("Kubernetes workloads found:", len(k8sWorkloads))
-	projectList, err := p.dpClient.GetProjectsByTag(p.ctx, client.EnvironmentTagPrefix.With(p.Cluster))
+// clientLister lists the deployments and naisjobs with a controller-runtime client
+type clientLister struct {
+	client k8s.Client
+	log    *log.Entry
+}
+
+func (l *clientLister) ListWorkloads(ctx context.Context) ([]*monitor.Workload, error) {
+	var deploymentList appsv1.DeploymentList
+	err := l.client.List(ctx, &deploymentList)
 	if err != nil {
-		return fmt.Errorf("error fetching projects: %v", err)
+		return nil, fmt.Errorf("error listing deployments: %v", err)
 	}
 
-	p.log.Infoln("DependencyTrack projects found:", len(projectList))
-	var projectData []*ProjectData
-	var numberofWorkloads int
-	for _, project := range projectList {
-		for _, tag := range project.Tags {
-			if strings.Contains(tag.Name, client.WorkloadTagPrefix.String()+""+p.Cluster+"|") {
-				workloadName := strings.Split(tag.Name, "|")[3]
-				numberofWorkloads++
-				if _, ok := k8sWorkloads[workloadName]; !ok {
-					p.log.Debug("Workload not found in Kubernetes: ", workloadName)
-					projectData = append(projectData, &ProjectData{
-						WorkloadTag: tag.Name,
-						Project:     project,
-					})
-				}
-			}
+	var jobList nais_io_v1.NaisjobList
+	if err = l.client.List(ctx, &jobList); err != nil {
+		if err.Error() != "no matches for kind \"Naisjob\" in version \"nais.io/v1\"" {
+			return nil, fmt.Errorf("error listing jobs: %v", err)
 		}
+		l.log.Println("Naisjob custom resource definition not found")
 	}
 
-	p.log.Infoln("Number of workloads found:", numberofWorkloads)
-	p.log.Infoln("Orphaned projects found:", len(projectData))
-	for _, pd := range projectData {
-		err = p.TidyWorkloadProject(pd.Project, pd.WorkloadTag, dryRun)
-		if err != nil {
-			return fmt.Errorf("error tidying project: %v", err)
-		}
+	workloads := make([]*monitor.Workload, 0, len(deploymentList.Items)+len(jobList.Items))
+	for i := range deploymentList.Items {
+		workloads = append(workloads, monitor.NewWorkload(&deploymentList.Items[i]))
+	}
+	for i := range jobList.Items {
+		workloads = append(workloads, monitor.NewWorkload(&jobList.Items[i]))
 	}
+	return workloads, nil
+}
 
-	var taglog string
-	var count int
-	for _, project := range projectList {
-		if !tagsContainsAllPrefixes(project.Tags, "rekor", "digest") {
-			count++
-			taglog += fmt.Sprintf("Project %s uuid %s has %d tags ||| ", project.Name, project.Uuid, len(project.Tags))
-			if dryRun {
-				p.log.Infoln("Dry run: skipping project deletion")
-				continue
-			}
-			if err = p.dpClient.DeleteProject(p.ctx, project.Uuid); err != nil {
-				p.log.Errorf("Error deleting project %s: %s", project.Name, err)
-			}
-		}
+// backfill verifies the attestation of the image of the project and adds the missing tags,
+// uploading the SBOM if the project has none
+func (p *Properties) backfill(a *Action) error {
+	metadata, err := p.Verifier.Verify(p.ctx, a.Image)
+	if err != nil {
+		return fmt.Errorf("error verifying attestation: %w", err)
+	}
+	if metadata.Statement == nil {
+		return fmt.Errorf("error verifying attestation: attestation has no statement")
 	}
-	if count > 0 {
-		p.log.Infoln("Projects with missing tags:", count)
-		p.log.Println(taglog)
+
+	tags := monitor.NewTags()
+	tags.ArrangeByPrefix(a.project.Tags)
+	tags.SetAttestationTags(metadata)
+	if _, err = p.dpClient.UpdateProject(p.ctx, a.ProjectUuid, a.ProjectName, a.ProjectVersion, a.project.Group, tags.GetAllTags()); err != nil {
+		return fmt.Errorf("error updating project: %v", err)
+	}
+
+	if a.project.LastBomImportFormat != "" {
+		return nil
+	}
+	b, err := json.Marshal(metadata.Statement.Predicate)
+	if err != nil {
+		return err
+	}
+	if err = p.dpClient.UploadProject(p.ctx, a.ProjectName, a.ProjectVersion, a.ProjectUuid, false, b); err != nil {
+		return fmt.Errorf("error uploading sbom: %v", err)
 	}
 	return nil
 }
 
+// projectImage returns the image the project was created for
+func projectImage(project *client.Project, tags *monitor.Tags) string {
+	if image := tags.GetImageTag(); image != "" {
+		return image
+	}
+	if strings.HasPrefix(project.Version, "sha256:") {
+		return project.Name + "@" + project.Version
+	}
+	return project.Name + ":" + project.Version
+}
+
 // find a string in a slice that contains a substring
 func tagsContainsAllPrefixes(tags []client.Tag, prefixes ...string) bool {
 	found := 0
@@ -2,22 +2,33 @@ package orphan
 
 import (
 	"context"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
 
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/monitor"
+	"slsa-verde/internal/test"
+	mockattestation "slsa-verde/mocks/internal_/attestation"
 	mockmonitor "slsa-verde/mocks/internal_/monitor"
 
 	"github.com/nais/dependencytrack/pkg/client"
 )
 
-func TestTidyWorkloadProject(t *testing.T) {
+func TestExecute(t *testing.T) {
 	mockClient := mockmonitor.NewClient(t)
 
 	props := New(context.Background(), mockClient, nil, "test-cluster", log.WithField("system", "test"))
@@ -28,18 +39,53 @@ func TestTidyWorkloadProject(t *testing.T) {
 		Tags: []client.Tag{{Name: "workload:cluster|namespace|type|name"}},
 	}
 
-	workloadTag := "workload:cluster|namespace|type|name"
-
 	t.Run("Successful project deletion", func(t *testing.T) {
 		mockClient.On("DeleteProject", mock.Anything, "test-uuid").Return(nil)
 
-		err := props.TidyWorkloadProject(project, workloadTag, false)
+		err := props.execute(&Action{
+			Type:         ActionDeleteProject,
+			ProjectUuid:  project.Uuid,
+			ProjectName:  project.Name,
+			WorkloadTags: []string{"workload:cluster|namespace|type|name"},
+			project:      project,
+		})
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
 
 		mockClient.AssertCalled(t, "DeleteProject", mock.Anything, "test-uuid")
 	})
+
+	t.Run("Workloads are marked deleted in v13s", func(t *testing.T) {
+		vulnz := &test.VulnerabilitiesClient{}
+		props.VulnerabilitiesClient = vulnz
+		defer func() { props.VulnerabilitiesClient = nil }()
+
+		versioned := &client.Project{
+			Name:    project.Name,
+			Uuid:    project.Uuid,
+			Version: "v1",
+			Tags:    []client.Tag{{Name: "workload:cluster|namespace|type|name"}, {Name: "digest:sha256:1"}, {Name: "rekor:1"}},
+		}
+		err := props.execute(&Action{
+			Type:           ActionDeleteProject,
+			ProjectUuid:    versioned.Uuid,
+			ProjectName:    versioned.Name,
+			ProjectVersion: versioned.Version,
+			WorkloadTags:   []string{"workload:cluster|namespace|type|name"},
+			project:        versioned,
+		})
+		assert.NoError(t, err)
+
+		if assert.Len(t, vulnz.Registered, 1) {
+			r := vulnz.Registered[0]
+			assert.Equal(t, []string{"cluster", "namespace", "type", "name", "test-project", "v1"}, []string{r.Cluster, r.Namespace, r.WorkloadType, r.Workload, r.ImageName, r.ImageTag})
+			assert.Equal(t, monitor.WorkloadStateDeleted, r.Metadata.Labels[monitor.WorkloadStateLabel])
+			// v13s replaces the labels of the registration
+			assert.Equal(t, "sha256:1", r.Metadata.Labels["digest"])
+			assert.Equal(t, "1", r.Metadata.Labels["rekor-log-index"])
+		}
+	})
 }
 
 func TestRunWithFakeK8sClient(t *testing.T) {
@@ -67,7 +113,7 @@ func TestRunWithFakeK8sClient(t *testing.T) {
 				Version: "latest",
 				Group:   "test-group",
 				Tags: []client.Tag{
-					{Name: "workload:test-cluster|default|type|test-deployment"},
+					{Name: "workload:test-cluster|default|app|test-deployment"},
 					{Name: "workload:test-cluster|namespace|type|name"},
 					{Name: "team:default"},
 					{Name: "image:latest"},
@@ -79,7 +125,7 @@ func TestRunWithFakeK8sClient(t *testing.T) {
 		}, nil)
 
 	mockClient.On("UpdateProject", mock.Anything, "test-uuid", "test-project", "latest", "test-group", []string{
-		"workload:test-cluster|default|type|test-deployment",
+		"workload:test-cluster|default|app|test-deployment",
 		"team:default",
 		"env:test-cluster",
 		"image:latest",
@@ -87,14 +133,18 @@ func TestRunWithFakeK8sClient(t *testing.T) {
 		"digest:sha256:123",
 	}).Return(&client.Project{}, nil)
 
-	err := props.Run(false)
+	report, err := props.Run(false)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	assert.Len(t, report.Actions, 1)
+	assert.Equal(t, ActionRemoveWorkloadTags, report.Actions[0].Type)
+	assert.Equal(t, []string{"workload:test-cluster|namespace|type|name"}, report.Actions[0].WorkloadTags)
+	assert.True(t, report.Actions[0].Executed)
 
 	mockClient.AssertCalled(t, "GetProjectsByTag", mock.Anything, "env:test-cluster")
 	mockClient.AssertCalled(t, "UpdateProject", mock.Anything, "test-uuid", "test-project", "latest", "test-group", []string{
-		"workload:test-cluster|default|type|test-deployment",
+		"workload:test-cluster|default|app|test-deployment",
 		"team:default",
 		"env:test-cluster",
 		"image:latest",
@@ -102,3 +152,322 @@ func TestRunWithFakeK8sClient(t *testing.T) {
 		"digest:sha256:123",
 	})
 }
+
+func TestRunMatchesFullWorkloadTag(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "team-a",
+		},
+	}
+	job := &nais_io_v1.Naisjob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myjob-1234",
+			Namespace: "team-a",
+			Labels:    map[string]string{"app": "myjob"},
+		},
+	}
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment, job).Build()
+	mockClient := mockmonitor.NewClient(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+
+	project := func(uuid, workloadTag string) *client.Project {
+		return &client.Project{
+			Name: uuid,
+			Uuid: uuid,
+			Tags: []client.Tag{
+				{Name: workloadTag},
+				{Name: "env:test-cluster"},
+				{Name: "rekor:1010"},
+				{Name: "digest:sha256:123"},
+			},
+		}
+	}
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			project("running-app", "workload:test-cluster|team-a|app|myapp"),
+			project("running-job", "workload:test-cluster|team-a|job|myjob"),
+			project("other-namespace", "workload:test-cluster|team-b|app|myapp"),
+			project("other-type", "workload:test-cluster|team-a|job|myapp"),
+			project("other-cluster", "workload:other-cluster|team-b|app|myapp"),
+		}, nil)
+	mockClient.On("DeleteProject", mock.Anything, "other-namespace").Return(nil)
+	mockClient.On("DeleteProject", mock.Anything, "other-type").Return(nil)
+
+	_, err := props.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mockClient.AssertNumberOfCalls(t, "DeleteProject", 2)
+}
+
+func TestRunBackfillsIncompleteProjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "team-a",
+		},
+	}
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment).Build()
+	mockClient := mockmonitor.NewClient(t)
+	verifier := mockattestation.NewVerifier(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+	props.Verifier = verifier
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			{
+				Name:    "ghcr.io/nais/myapp",
+				Uuid:    "running",
+				Version: "v1",
+				Tags: []client.Tag{
+					{Name: "workload:test-cluster|team-a|app|myapp"},
+					{Name: "env:test-cluster"},
+					{Name: "image:ghcr.io/nais/myapp:v1"},
+				},
+			},
+			{
+				Name:    "ghcr.io/nais/gone",
+				Uuid:    "gone",
+				Version: "v1",
+				Tags:    []client.Tag{{Name: "env:test-cluster"}},
+			},
+		}, nil)
+
+	var statement in_toto.CycloneDXStatement
+	verifier.On("Verify", mock.Anything, "ghcr.io/nais/myapp:v1").Return(&attestation.ImageMetadata{
+		Image:         "ghcr.io/nais/myapp:v1",
+		Digest:        "sha256:123",
+		Statement:     &statement,
+		RekorMetadata: &attestation.Rekor{LogIndex: "1010"},
+	}, nil)
+	mockClient.On("UpdateProject", mock.Anything, "running", "ghcr.io/nais/myapp", "v1", "", mock.MatchedBy(func(tags []string) bool {
+		return slices.Contains(tags, "workload:test-cluster|team-a|app|myapp") &&
+			slices.Contains(tags, "digest:sha256:123") &&
+			slices.Contains(tags, "rekor:1010")
+	})).Return(&client.Project{}, nil)
+	mockClient.On("UploadProject", mock.Anything, "ghcr.io/nais/myapp", "v1", "running", false, mock.Anything).Return(nil)
+	mockClient.On("DeleteProject", mock.Anything, "gone").Return(nil)
+
+	report, err := props.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	assert.Len(t, report.Actions, 2)
+	assert.Equal(t, ActionBackfillProject, report.Actions[0].Type)
+	assert.Equal(t, "ghcr.io/nais/myapp:v1", report.Actions[0].Image)
+	assert.True(t, report.Actions[0].Executed)
+	assert.Equal(t, ActionDeleteUntaggedProject, report.Actions[1].Type)
+	assert.True(t, report.Actions[1].Executed)
+	assert.Equal(t, 1, report.Deletions)
+	mockClient.AssertNotCalled(t, "DeleteProject", mock.Anything, "running")
+}
+
+func TestRunKeepsProjectWhenBackfillFails(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "team-a",
+		},
+	}
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment).Build()
+	mockClient := mockmonitor.NewClient(t)
+	verifier := mockattestation.NewVerifier(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+	props.Verifier = verifier
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			{
+				Name:    "ghcr.io/nais/myapp",
+				Uuid:    "running",
+				Version: "sha256:123",
+				Tags:    []client.Tag{{Name: "workload:test-cluster|team-a|app|myapp"}},
+			},
+		}, nil)
+	verifier.On("Verify", mock.Anything, "ghcr.io/nais/myapp@sha256:123").Return(nil, attestation.ErrNoAttestation)
+
+	report, err := props.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	assert.Len(t, report.Actions, 1)
+	assert.Equal(t, ActionBackfillProject, report.Actions[0].Type)
+	assert.False(t, report.Actions[0].Executed)
+	assert.NotEmpty(t, report.Actions[0].Error)
+	mockClient.AssertNotCalled(t, "DeleteProject", mock.Anything, mock.Anything)
+	mockClient.AssertNotCalled(t, "UpdateProject", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRunAbortsWhenBudgetExceeded(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	// no workloads listed, e.g. the client is configured for the wrong cluster
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	mockClient := mockmonitor.NewClient(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+	props.Budget = Budget{MaxDeletions: 1}
+
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			{Uuid: "uuid1", Tags: []client.Tag{{Name: "workload:test-cluster|team-a|app|app1"}}},
+			{Uuid: "uuid2", Tags: []client.Tag{{Name: "workload:test-cluster|team-a|app|app2"}}},
+		}, nil)
+
+	report, err := props.Run(false)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.True(t, report.Aborted)
+	assert.Equal(t, 2, report.Deletions)
+	for _, a := range report.Actions {
+		assert.False(t, a.Executed)
+	}
+	mockClient.AssertNotCalled(t, "DeleteProject", mock.Anything, mock.Anything)
+}
+
+func TestBudgetCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		budget    Budget
+		deletions int
+		total     int
+		wantErr   bool
+	}{
+		{name: "disabled", budget: Budget{}, deletions: 100, total: 100},
+		{name: "within count", budget: Budget{MaxDeletions: 10}, deletions: 10, total: 100},
+		{name: "exceeds count", budget: Budget{MaxDeletions: 10}, deletions: 11, total: 100, wantErr: true},
+		{name: "within percentage", budget: Budget{MaxDeletionPercentage: 20}, deletions: 20, total: 100},
+		{name: "exceeds percentage", budget: Budget{MaxDeletionPercentage: 20}, deletions: 21, total: 100, wantErr: true},
+		{name: "no projects", budget: Budget{MaxDeletionPercentage: 20}, deletions: 0, total: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.budget.check(tt.deletions, tt.total)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBudgetExceeded)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRunPrunesSupersededProjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "team-a",
+		},
+	}
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment).Build()
+	mockClient := mockmonitor.NewClient(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+	props.Retention = monitor.Retention{Versions: 1}
+
+	superseded := func(uuid, workload string, at time.Time) *client.Project {
+		return &client.Project{
+			Name: uuid,
+			Uuid: uuid,
+			Tags: []client.Tag{
+				{Name: "superseded:" + workload},
+				{Name: "superseded-at:" + strconv.FormatInt(at.Unix(), 10)},
+				{Name: "env:test-cluster"},
+				{Name: "rekor:1010"},
+				{Name: "digest:sha256:123"},
+			},
+		}
+	}
+	now := time.Now()
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			superseded("latest", "test-cluster|team-a|app|myapp", now),
+			superseded("expired", "test-cluster|team-a|app|myapp", now.Add(-time.Hour)),
+			superseded("workload-gone", "test-cluster|team-a|app|gone", now),
+		}, nil)
+	mockClient.On("DeleteProject", mock.Anything, "expired").Return(nil)
+	mockClient.On("DeleteProject", mock.Anything, "workload-gone").Return(nil)
+
+	report, err := props.Run(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Deletions)
+	for _, a := range report.Actions {
+		assert.Equal(t, ActionPruneSupersededProject, a.Type)
+		assert.True(t, a.Executed)
+	}
+}
+
+func TestRunRemovesWorkloadsScaledDownPastGracePeriod(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = nais_io_v1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	var deployments []k8s.Object
+	for _, name := range []string{"dormant", "recent", "shared"} {
+		deployments = append(deployments, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"}})
+	}
+	fakeK8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployments...).Build()
+	mockClient := mockmonitor.NewClient(t)
+	props := New(context.Background(), mockClient, fakeK8sClient, "test-cluster", log.WithField("system", "test"))
+	props.ScaledDownGracePeriod = 24 * time.Hour
+	vulnz := &test.VulnerabilitiesClient{}
+	props.VulnerabilitiesClient = vulnz
+
+	key := func(name string) monitor.WorkloadKey {
+		return monitor.WorkloadKey{Cluster: "test-cluster", Namespace: "team-a", Type: "app", Name: name}
+	}
+	project := func(uuid string, tags ...string) *client.Project {
+		p := &client.Project{Name: uuid, Uuid: uuid, Tags: []client.Tag{
+			{Name: "env:test-cluster"},
+			{Name: "rekor:1010"},
+			{Name: "digest:sha256:123"},
+		}}
+		for _, tag := range tags {
+			p.Tags = append(p.Tags, client.Tag{Name: tag})
+		}
+		return p
+	}
+	longAgo := time.Now().Add(-48 * time.Hour)
+	mockClient.On("GetProjectsByTag", mock.Anything, "env:test-cluster").
+		Return([]*client.Project{
+			project("dormant", key("dormant").Tag(), key("dormant").ScaledDownTag(longAgo)),
+			project("recent", key("recent").Tag(), key("recent").ScaledDownTag(time.Now())),
+			project("shared", key("shared").Tag(), key("dormant").Tag(), key("dormant").ScaledDownTag(longAgo)),
+			// deleted while it was scaled down
+			project("gone", key("gone").Tag(), key("gone").ScaledDownTag(time.Now())),
+		}, nil)
+	mockClient.On("DeleteProject", mock.Anything, "dormant").Return(nil)
+	mockClient.On("DeleteProject", mock.Anything, "gone").Return(nil)
+	mockClient.On("UpdateProject", mock.Anything, "shared", "shared", "", "", mock.MatchedBy(func(tags []string) bool {
+		return slices.Contains(tags, key("shared").Tag()) && !slices.Contains(tags, key("dormant").Tag()) &&
+			!slices.Contains(tags, key("dormant").ScaledDownTag(longAgo))
+	})).Return(nil, nil)
+
+	report, err := props.Run(false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Actions, 3)
+	mockClient.AssertNumberOfCalls(t, "DeleteProject", 2)
+
+	// only the workload that is gone is marked deleted in v13s, dormant workloads still exist
+	assert.Len(t, vulnz.Registered, 1)
+	assert.Equal(t, "gone", vulnz.Registered[0].Workload)
+}
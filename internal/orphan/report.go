@@ -0,0 +1,105 @@
+package orphan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+)
+
+var ErrBudgetExceeded = errors.New("deletion budget exceeded")
+
+type ActionType string
+
+const (
+	// ActionDeleteProject deletes a project whose workloads are all gone
+	ActionDeleteProject ActionType = "delete-project"
+	// ActionRemoveWorkloadTags removes the tags of the workloads that are gone from a project still used by other workloads
+	ActionRemoveWorkloadTags ActionType = "remove-workload-tags"
+	// ActionDeleteUntaggedProject deletes a project missing the tags added when its attestation was verified
+	ActionDeleteUntaggedProject ActionType = "delete-untagged-project"
+	// ActionBackfillProject re-verifies the image of a project missing the tags added when its attestation was
+	// verified, its workloads still exist
+	ActionBackfillProject ActionType = "backfill-project"
+	// ActionPruneSupersededProject deletes a project of a previous version of a workload beyond the retention or
+	// whose workload is gone
+	ActionPruneSupersededProject ActionType = "prune-superseded-project"
+)
+
+// Action is a change to a project planned by a run, executed unless the run is a dry run or aborted.
+type Action struct {
+	Type           ActionType `json:"type"`
+	ProjectUuid    string     `json:"projectUuid"`
+	ProjectName    string     `json:"projectName"`
+	ProjectVersion string     `json:"projectVersion"`
+	Image          string     `json:"image,omitempty"`
+	WorkloadTags   []string   `json:"workloadTags,omitempty"`
+	// DormantWorkloadTags are the workload tags removed because their workloads are scaled down longer than the
+	// grace period, the workloads still exist
+	DormantWorkloadTags []string `json:"dormantWorkloadTags,omitempty"`
+	Reason              string   `json:"reason"`
+	Executed            bool     `json:"executed"`
+	Error               string   `json:"error,omitempty"`
+
+	project *client.Project
+}
+
+func (a *Action) isDeletion() bool {
+	return a.Type == ActionDeleteProject || a.Type == ActionDeleteUntaggedProject || a.Type == ActionPruneSupersededProject
+}
+
+// outcome of the action for metrics, planned if it was not executed by a dry run or an aborted run
+func (a *Action) outcome() string {
+	switch {
+	case a.Executed:
+		return "executed"
+	case a.Error != "":
+		return "failed"
+	default:
+		return "planned"
+	}
+}
+
+// Budget limits the number of projects a run is allowed to delete, a zero value disables the limit.
+type Budget struct {
+	MaxDeletions int
+	// MaxDeletionPercentage of the projects in the cluster
+	MaxDeletionPercentage float64
+}
+
+// check returns an error if deleting deletions of total projects exceeds the budget
+func (b Budget) check(deletions, total int) error {
+	if b.MaxDeletions > 0 && deletions > b.MaxDeletions {
+		return fmt.Errorf("%w: %d deletions planned, at most %d allowed", ErrBudgetExceeded, deletions, b.MaxDeletions)
+	}
+	if b.MaxDeletionPercentage > 0 && total > 0 {
+		percentage := float64(deletions) / float64(total) * 100
+		if percentage > b.MaxDeletionPercentage {
+			return fmt.Errorf("%w: %d of %d projects (%.1f%%) planned for deletion, at most %.1f%% allowed", ErrBudgetExceeded, deletions, total, percentage, b.MaxDeletionPercentage)
+		}
+	}
+	return nil
+}
+
+// Report describes what a run found and the actions it planned.
+type Report struct {
+	Cluster     string    `json:"cluster"`
+	DryRun      bool      `json:"dryRun"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Workloads   int       `json:"workloads"`
+	Projects    int       `json:"projects"`
+	Deletions   int       `json:"deletions"`
+	Aborted     bool      `json:"aborted"`
+	AbortReason string    `json:"abortReason,omitempty"`
+	Actions     []*Action `json:"actions"`
+}
+
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
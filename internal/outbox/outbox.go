@@ -0,0 +1,309 @@
+package outbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/observability"
+)
+
+const (
+	defaultInterval   = 10 * time.Second
+	defaultMinBackoff = 10 * time.Second
+	defaultMaxBackoff = 10 * time.Minute
+	defaultMaxAge     = 24 * time.Hour
+)
+
+// Handler replays the write of an entry, the entry is kept and retried with backoff if it returns an error
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Entry is a pending write to a backend, persisted as a file in the outbox directory.
+type Entry struct {
+	Kind        string          `json:"kind"`
+	Key         string          `json:"key"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Outbox persists writes that failed because a backend was unavailable and replays them with backoff.
+// An entry replaces a pending entry of the same kind and key, entries older than MaxAge are dropped.
+type Outbox struct {
+	dir      string
+	handlers map[string]Handler
+	mu       sync.Mutex
+	// kinds are the kinds of the entries on disk by path, kept in memory for the depth metric
+	kinds map[string]string
+	depth map[string]int
+	log   *log.Entry
+
+	Interval   time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	MaxAge     time.Duration
+}
+
+func New(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create outbox directory: %w", err)
+	}
+	o := &Outbox{
+		dir:        dir,
+		handlers:   make(map[string]Handler),
+		kinds:      make(map[string]string),
+		depth:      make(map[string]int),
+		log:        log.WithField("component", "outbox"),
+		Interval:   defaultInterval,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		MaxAge:     defaultMaxAge,
+	}
+	entries, err := o.entries()
+	if err != nil {
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	for _, e := range entries {
+		o.track(e.Kind, o.path(e.Kind, e.Key))
+	}
+	return o, nil
+}
+
+// Handle registers the handler replaying entries of the kind, handlers must be registered before Run
+func (o *Outbox) Handle(kind string, handler Handler) {
+	o.handlers[kind] = handler
+	observability.OutboxDepth.WithLabelValues(kind).Set(float64(o.depth[kind]))
+}
+
+// Add persists a pending write of the kind, replacing a pending write with the same key
+func (o *Outbox) Add(kind, key string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal outbox payload: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	return o.write(&Entry{
+		Kind:        kind,
+		Key:         key,
+		Payload:     b,
+		CreatedAt:   now,
+		NextAttempt: now.Add(o.MinBackoff),
+	})
+}
+
+// Remove drops the pending write of the kind with the key, if any
+func (o *Outbox) Remove(kind, key string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.delete(o.path(kind, key))
+}
+
+// Run replays the due entries every interval until ctx is done
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.replay(ctx)
+		}
+	}
+}
+
+// replay runs the handlers of the due entries. Handlers and the monitor may add or remove entries while the
+// outbox is replayed, an entry is only updated or removed after its replay if it was not replaced meanwhile.
+func (o *Outbox) replay(ctx context.Context) {
+	o.mu.Lock()
+	entries, err := o.entries()
+	o.mu.Unlock()
+	if err != nil {
+		o.log.Warnf("read outbox: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		l := o.log.WithFields(log.Fields{"kind": e.Kind, "key": e.Key})
+		if now.Sub(e.CreatedAt) > o.MaxAge {
+			l.Warnf("dropping entry after %d attempts, last error: %s", e.Attempts, e.LastError)
+			observability.OutboxReplays.WithLabelValues(e.Kind, "dropped").Inc()
+			o.remove(e)
+			continue
+		}
+		if now.Before(e.NextAttempt) {
+			continue
+		}
+
+		handler, ok := o.handlers[e.Kind]
+		if !ok {
+			l.Warn("dropping entry of unknown kind")
+			observability.OutboxReplays.WithLabelValues(e.Kind, "dropped").Inc()
+			o.remove(e)
+			continue
+		}
+
+		if err := handler(ctx, e.Payload); err != nil {
+			e.Attempts++
+			e.LastError = err.Error()
+			e.NextAttempt = now.Add(o.backoff(e.Attempts))
+			l.Debugf("replay failed, retrying at %s: %v", e.NextAttempt.Format(time.RFC3339), err)
+			observability.OutboxReplays.WithLabelValues(e.Kind, "failed").Inc()
+			o.mu.Lock()
+			if o.current(e) {
+				if err := o.write(e); err != nil {
+					l.Warnf("update entry: %v", err)
+				}
+			}
+			o.mu.Unlock()
+			continue
+		}
+		l.Infof("replayed after %d failed attempts", e.Attempts)
+		observability.OutboxReplays.WithLabelValues(e.Kind, "success").Inc()
+		o.remove(e)
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.MinBackoff
+	for i := 1; i < attempts && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, o.MaxBackoff)
+}
+
+// remove removes the replayed entry unless it was replaced or removed while it was replayed
+func (o *Outbox) remove(e *Entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.current(e) {
+		return
+	}
+	if err := o.delete(o.path(e.Kind, e.Key)); err != nil {
+		o.log.Warnf("remove entry: %v", err)
+	}
+}
+
+// current returns whether the entry on disk is still the one read for replay, o.mu must be held
+func (o *Outbox) current(e *Entry) bool {
+	b, err := os.ReadFile(o.path(e.Kind, e.Key))
+	if err != nil {
+		return false
+	}
+	onDisk := &Entry{}
+	if err := json.Unmarshal(b, onDisk); err != nil {
+		return false
+	}
+	return onDisk.CreatedAt.Equal(e.CreatedAt)
+}
+
+// delete removes the entry file at path, o.mu must be held
+func (o *Outbox) delete(path string) error {
+	if _, ok := o.kinds[path]; !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	o.untrack(path)
+	return nil
+}
+
+// write persists the entry atomically, a crash leaves either the previous or the new entry
+func (o *Outbox) write(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal outbox entry: %w", err)
+	}
+	tmp, err := os.CreateTemp(o.dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	path := o.path(e.Kind, e.Key)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	o.track(e.Kind, path)
+	return nil
+}
+
+// entries reads the entries on disk, o.mu must be held
+func (o *Outbox) entries() ([]*Entry, error) {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(o.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(b, e); err != nil {
+			o.log.Warnf("dropping unreadable entry %s: %v", f.Name(), err)
+			_ = os.Remove(filepath.Join(o.dir, f.Name()))
+			o.untrack(filepath.Join(o.dir, f.Name()))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// track counts the entry at path in the depth metric unless it replaces a counted entry
+func (o *Outbox) track(kind, path string) {
+	if _, ok := o.kinds[path]; ok {
+		return
+	}
+	o.kinds[path] = kind
+	o.depth[kind]++
+	observability.OutboxDepth.WithLabelValues(kind).Set(float64(o.depth[kind]))
+}
+
+func (o *Outbox) untrack(path string) {
+	kind, ok := o.kinds[path]
+	if !ok {
+		return
+	}
+	delete(o.kinds, path)
+	o.depth[kind]--
+	observability.OutboxDepth.WithLabelValues(kind).Set(float64(o.depth[kind]))
+}
+
+func (o *Outbox) path(kind, key string) string {
+	sum := sha256.Sum256([]byte(kind + "/" + key))
+	return filepath.Join(o.dir, kind+"-"+hex.EncodeToString(sum[:8])+".json")
+}
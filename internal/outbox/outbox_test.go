@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"slsa-verde/internal/observability"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	o, err := New(dir)
+	assert.NoError(t, err)
+	o.MinBackoff = 0
+
+	var replayed []string
+	fail := true
+	o.Handle("register", func(_ context.Context, payload json.RawMessage) error {
+		var name string
+		if err := json.Unmarshal(payload, &name); err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("unavailable")
+		}
+		replayed = append(replayed, name)
+		return nil
+	})
+
+	assert.NoError(t, o.Add("register", "a", "first"))
+	assert.NoError(t, o.Add("register", "a", "second"))
+	assert.NoError(t, o.Add("register", "b", "other"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(observability.OutboxDepth.WithLabelValues("register")))
+
+	o.replay(context.Background())
+	entries, err := o.entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Equal(t, 1, e.Attempts)
+		assert.Equal(t, "unavailable", e.LastError)
+	}
+
+	// entries survive a restart
+	o, err = New(dir)
+	assert.NoError(t, err)
+	o.MinBackoff = 0
+	o.Handle("register", func(_ context.Context, payload json.RawMessage) error {
+		var name string
+		_ = json.Unmarshal(payload, &name)
+		replayed = append(replayed, name)
+		return nil
+	})
+	for _, e := range entries {
+		e.NextAttempt = time.Now()
+		assert.NoError(t, o.write(e))
+	}
+
+	o.replay(context.Background())
+	assert.ElementsMatch(t, []string{"second", "other"}, replayed)
+	entries, err = o.entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, float64(0), testutil.ToFloat64(observability.OutboxDepth.WithLabelValues("register")))
+}
+
+func TestReplayDropsExpiredEntries(t *testing.T) {
+	o, err := New(t.TempDir())
+	assert.NoError(t, err)
+	o.MaxAge = time.Minute
+	o.Handle("register", func(context.Context, json.RawMessage) error {
+		t.Fatal("expired entry replayed")
+		return nil
+	})
+
+	assert.NoError(t, o.write(&Entry{Kind: "register", Key: "a", Payload: json.RawMessage(`"a"`), CreatedAt: time.Now().Add(-time.Hour)}))
+	o.replay(context.Background())
+
+	entries, err := o.entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReplayKeepsEntriesChangedWhileReplayed(t *testing.T) {
+	o, err := New(t.TempDir())
+	assert.NoError(t, err)
+	o.MinBackoff = 0
+
+	o.Handle("verify", func(_ context.Context, payload json.RawMessage) error {
+		var name string
+		_ = json.Unmarshal(payload, &name)
+		switch name {
+		case "replaced":
+			// a newer write of the same key must not be removed by the successful replay
+			return o.Add("verify", "a", "newer")
+		case "removed":
+			// a removed entry must not be written back by the failed replay
+			if err := o.Remove("verify", "b"); err != nil {
+				return err
+			}
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	assert.NoError(t, o.Add("verify", "a", "replaced"))
+	assert.NoError(t, o.Add("verify", "b", "removed"))
+	o.replay(context.Background())
+
+	entries, err := o.entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "a", entries[0].Key)
+	assert.JSONEq(t, `"newer"`, string(entries[0].Payload))
+	assert.Equal(t, float64(1), testutil.ToFloat64(observability.OutboxDepth.WithLabelValues("verify")))
+}
+
+func TestRemove(t *testing.T) {
+	o, err := New(t.TempDir())
+	assert.NoError(t, err)
+
+	assert.NoError(t, o.Add("verify", "a", "a"))
+	assert.NoError(t, o.Remove("verify", "a"))
+	assert.NoError(t, o.Remove("verify", "missing"))
+
+	entries, err := o.entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestBackoff(t *testing.T) {
+	o := &Outbox{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, o.backoff(1))
+	assert.Equal(t, 2*time.Second, o.backoff(2))
+	assert.Equal(t, 4*time.Second, o.backoff(3))
+	assert.Equal(t, 5*time.Second, o.backoff(4))
+	assert.Equal(t, 5*time.Second, o.backoff(10))
+}
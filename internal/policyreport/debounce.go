@@ -0,0 +1,70 @@
+package policyreport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type syncer interface {
+	Sync(ctx context.Context, namespace string) error
+}
+
+// Debounced marks the namespaces passed to Sync dirty and syncs their reports from Run once per interval,
+// a burst of events in a namespace results in a single sync off the informer handlers.
+type Debounced struct {
+	syncer   syncer
+	interval time.Duration
+	logger   *log.Entry
+
+	mu    sync.Mutex
+	dirty map[string]struct{}
+}
+
+func NewDebounced(s syncer, interval time.Duration) *Debounced {
+	return &Debounced{
+		syncer:   s,
+		interval: interval,
+		logger:   log.WithField("package", "policyreport"),
+		dirty:    make(map[string]struct{}),
+	}
+}
+
+// Sync marks the report of namespace to be synced by Run, it never fails
+func (d *Debounced) Sync(_ context.Context, namespace string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dirty[namespace] = struct{}{}
+	return nil
+}
+
+// Run syncs the dirty namespaces every interval until ctx is done
+func (d *Debounced) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.flush(ctx)
+		}
+	}
+}
+
+// flush syncs the dirty namespaces, namespaces failing to sync are marked dirty again to be retried
+func (d *Debounced) flush(ctx context.Context) {
+	d.mu.Lock()
+	dirty := d.dirty
+	d.dirty = make(map[string]struct{})
+	d.mu.Unlock()
+
+	for namespace := range dirty {
+		if err := d.syncer.Sync(ctx, namespace); err != nil {
+			d.logger.WithField("namespace", namespace).Warnf("sync policy report: %v", err)
+			_ = d.Sync(ctx, namespace)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package policyreport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSyncer struct {
+	synced []string
+	fail   bool
+}
+
+func (f *fakeSyncer) Sync(_ context.Context, namespace string) error {
+	f.synced = append(f.synced, namespace)
+	if f.fail {
+		return errors.New("conflict")
+	}
+	return nil
+}
+
+func TestDebounced(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeSyncer{}
+	d := NewDebounced(s, time.Minute)
+
+	for range 3 {
+		assert.NoError(t, d.Sync(ctx, "ns1"))
+	}
+	assert.Empty(t, s.synced)
+
+	d.flush(ctx)
+	assert.Equal(t, []string{"ns1"}, s.synced)
+
+	d.flush(ctx)
+	assert.Equal(t, []string{"ns1"}, s.synced)
+
+	// failed syncs are retried on the next flush
+	s.fail = true
+	assert.NoError(t, d.Sync(ctx, "ns2"))
+	d.flush(ctx)
+	s.fail = false
+	d.flush(ctx)
+	assert.Equal(t, []string{"ns1", "ns2", "ns2"}, s.synced)
+}
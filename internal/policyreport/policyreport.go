@@ -0,0 +1,199 @@
+package policyreport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+)
+
+const (
+	ReportName = "slsa-verde"
+	Policy     = "slsa-verde"
+	Source     = "slsa-verde"
+
+	RuleSbomAttested    = "sbom-attested"
+	RuleTrustedIdentity = "trusted-identity"
+)
+
+// Result values defined by the Policy Report API
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultWarn  = "warn"
+	ResultError = "error"
+	ResultSkip  = "skip"
+)
+
+var GroupVersionResource = schema.GroupVersionResource{
+	Group:    "wgpolicyk8s.io",
+	Version:  "v1alpha2",
+	Resource: "policyreports",
+}
+
+var workloadKinds = map[string]metav1.TypeMeta{
+	"app": {APIVersion: "apps/v1", Kind: "Deployment"},
+	"job": {APIVersion: "nais.io/v1", Kind: "Naisjob"},
+}
+
+// Reporter publishes the verification state of the workloads in a namespace as a PolicyReport.
+type Reporter struct {
+	client dynamic.Interface
+	store  *state.Store
+	logger *log.Entry
+	// mu serializes syncs, reports are updated from the handlers of several informers
+	mu sync.Mutex
+}
+
+func New(client dynamic.Interface, store *state.Store) *Reporter {
+	return &Reporter{
+		client: client,
+		store:  store,
+		logger: log.WithField("package", "policyreport"),
+	}
+}
+
+// Sync creates, updates or deletes the report of namespace to match the workloads in the store
+func (r *Reporter) Sync(ctx context.Context, namespace string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	workloads := r.store.List(namespace)
+	reports := r.client.Resource(GroupVersionResource).Namespace(namespace)
+	if len(workloads) == 0 {
+		err := reports.Delete(ctx, ReportName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete policy report: %w", err)
+		}
+		return nil
+	}
+
+	results, summary := buildResults(workloads)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		report, err := reports.Get(ctx, ReportName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			report = &unstructured.Unstructured{}
+			report.SetAPIVersion(GroupVersionResource.GroupVersion().String())
+			report.SetKind("PolicyReport")
+			report.SetName(ReportName)
+			report.SetNamespace(namespace)
+			report.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "slsa-verde"})
+			report.Object["results"] = results
+			report.Object["summary"] = summary
+			if _, err = reports.Create(ctx, report, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("create policy report: %w", err)
+			}
+			r.logger.WithField("namespace", namespace).Debug("policy report created")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get policy report: %w", err)
+		}
+
+		report.Object["results"] = results
+		report.Object["summary"] = summary
+		if _, err = reports.Update(ctx, report, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func buildResults(workloads []state.Workload) ([]any, map[string]any) {
+	counts := map[string]int64{
+		ResultPass:  0,
+		ResultFail:  0,
+		ResultWarn:  0,
+		ResultError: 0,
+		ResultSkip:  0,
+	}
+
+	results := make([]any, 0)
+	for _, w := range workloads {
+		for _, c := range w.Containers {
+			sbomAttested, trustedIdentity := ruleResults(c.Status)
+			for _, rr := range []struct{ rule, result string }{
+				{RuleSbomAttested, sbomAttested},
+				{RuleTrustedIdentity, trustedIdentity},
+			} {
+				counts[rr.result]++
+				results = append(results, result(w, c, rr.rule, rr.result))
+			}
+		}
+	}
+
+	summary := make(map[string]any, len(counts))
+	for k, v := range counts {
+		summary[k] = v
+	}
+	return results, summary
+}
+
+// ruleResults maps the verification status of a container to the results of the rules
+func ruleResults(status attestation.Status) (sbomAttested, trustedIdentity string) {
+	switch status {
+	case attestation.StatusVerified:
+		return ResultPass, ResultPass
+	case attestation.StatusUnsigned, attestation.StatusInvalidSignature:
+		return ResultFail, ResultSkip
+	case attestation.StatusUntrustedIdentity:
+		return ResultSkip, ResultFail
+	case attestation.StatusPolicyViolation:
+		return ResultFail, ResultPass
+	default:
+		return ResultError, ResultError
+	}
+}
+
+func result(w state.Workload, c state.Container, rule, res string) map[string]any {
+	message := fmt.Sprintf("container %s with image %s: %s", c.Name, c.Image, c.Status)
+	if c.Error != "" {
+		message += ": " + c.Error
+	}
+
+	properties := map[string]any{
+		"container": c.Name,
+		"image":     c.Image,
+		"status":    c.Status.String(),
+	}
+	if c.Digest != "" {
+		properties["digest"] = c.Digest
+	}
+	if c.Rekor != nil && c.Rekor.LogIndex != "" {
+		properties["rekorLogIndex"] = c.Rekor.LogIndex
+	}
+
+	kind := workloadKinds[w.Type]
+	return map[string]any{
+		"policy":   Policy,
+		"rule":     rule,
+		"result":   res,
+		"source":   Source,
+		"scored":   true,
+		"category": "Supply Chain Security",
+		"message":  message,
+		"timestamp": map[string]any{
+			"seconds": c.VerifiedAt.Unix(),
+			"nanos":   int64(0),
+		},
+		"resources": []any{
+			map[string]any{
+				"apiVersion": kind.APIVersion,
+				"kind":       kind.Kind,
+				"name":       w.Name,
+				"namespace":  w.Namespace,
+			},
+		},
+		"properties": properties,
+	}
+}
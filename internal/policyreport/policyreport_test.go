@@ -0,0 +1,88 @@
+package policyreport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/state"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GroupVersionResource: "PolicyReportList",
+	})
+	store := state.NewStore()
+	reporter := New(client, store)
+	verifiedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	get := func() *unstructured.Unstructured {
+		report, err := client.Resource(GroupVersionResource).Namespace("ns1").Get(ctx, ReportName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		return report
+	}
+
+	t.Run("should create report with a result per rule and container", func(t *testing.T) {
+		store.SetContainer("ns1", "app1", "app", state.Container{Name: "app1", Image: "app1:1", Status: attestation.StatusVerified, VerifiedAt: verifiedAt})
+		store.SetContainer("ns1", "app1", "app", state.Container{Name: "sidecar", Image: "sidecar:1", Status: attestation.StatusUnsigned, VerifiedAt: verifiedAt})
+		assert.NoError(t, reporter.Sync(ctx, "ns1"))
+
+		report := get()
+		results, _, _ := unstructured.NestedSlice(report.Object, "results")
+		assert.Len(t, results, 4)
+		assert.Equal(t, "sbom-attested", results[0].(map[string]any)["rule"])
+		assert.Equal(t, "pass", results[0].(map[string]any)["result"])
+		assert.Equal(t, "fail", results[2].(map[string]any)["result"])
+
+		summary, _, _ := unstructured.NestedMap(report.Object, "summary")
+		assert.Equal(t, map[string]any{"pass": int64(2), "fail": int64(1), "warn": int64(0), "error": int64(0), "skip": int64(1)}, summary)
+	})
+
+	t.Run("should update report", func(t *testing.T) {
+		store.SetContainer("ns1", "app1", "app", state.Container{Name: "sidecar", Image: "sidecar:2", Status: attestation.StatusVerified, VerifiedAt: verifiedAt})
+		assert.NoError(t, reporter.Sync(ctx, "ns1"))
+
+		summary, _, _ := unstructured.NestedMap(get().Object, "summary")
+		assert.Equal(t, int64(4), summary["pass"])
+	})
+
+	t.Run("should delete report when the namespace has no workloads", func(t *testing.T) {
+		store.Delete("ns1", "app", "app1")
+		assert.NoError(t, reporter.Sync(ctx, "ns1"))
+		assert.NoError(t, reporter.Sync(ctx, "ns1"))
+
+		_, err := client.Resource(GroupVersionResource).Namespace("ns1").Get(ctx, ReportName, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+}
+
+func TestRuleResults(t *testing.T) {
+	for _, tt := range []struct {
+		status              attestation.Status
+		wantSbomAttested    string
+		wantTrustedIdentity string
+	}{
+		{attestation.StatusVerified, ResultPass, ResultPass},
+		{attestation.StatusUnsigned, ResultFail, ResultSkip},
+		{attestation.StatusInvalidSignature, ResultFail, ResultSkip},
+		{attestation.StatusUntrustedIdentity, ResultSkip, ResultFail},
+		{attestation.StatusPolicyViolation, ResultFail, ResultPass},
+		{attestation.StatusRegistryError, ResultError, ResultError},
+	} {
+		t.Run(tt.status.String(), func(t *testing.T) {
+			sbomAttested, trustedIdentity := ruleResults(tt.status)
+			assert.Equal(t, tt.wantSbomAttested, sbomAttested)
+			assert.Equal(t, tt.wantTrustedIdentity, trustedIdentity)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"golang.org/x/sync/singleflight"
+
+	"slsa-verde/internal/sbomstore"
+)
+
+// maxGranted bounds the grants remembered to skip repeated mappings, they are forgotten once it is reached as
+// mapping a project again is harmless
+const maxGranted = 10000
+
+// Permissions of the teams created for namespaces, they can view their projects and audit their findings
+var Permissions = []client.Permission{
+	"VIEW_PORTFOLIO",
+	"VIEW_VULNERABILITY",
+	"VULNERABILITY_ANALYSIS",
+}
+
+// Access grants the Dependency-Track team of a namespace access to the projects of its workloads, teams only see
+// their own projects when portfolio access control is enabled in Dependency-Track.
+type Access struct {
+	client client.Client
+	api    *sbomstore.API
+	// teams maps namespaces to the name of their team, the team is named after the namespace if not mapped
+	teams map[string]string
+
+	// mu guards the maps only, lookups of a team are shared by concurrent grants to it
+	mu        sync.Mutex
+	teamUuids map[string]string
+	granted   map[string]bool
+	lookups   singleflight.Group
+}
+
+func New(c client.Client, api string, teams map[string]string) *Access {
+	return &Access{
+		client:    c,
+		api:       sbomstore.NewAPI(c, api),
+		teams:     teams,
+		teamUuids: make(map[string]string),
+		granted:   make(map[string]bool),
+	}
+}
+
+// Team returns the name of the team of the namespace
+func (a *Access) Team(namespace string) string {
+	if team, ok := a.teams[namespace]; ok && team != "" {
+		return team
+	}
+	return namespace
+}
+
+// Grant gives the team of the namespace access to the project, creating the team if it does not exist
+func (a *Access) Grant(ctx context.Context, namespace string, project *client.Project) error {
+	team := a.Team(namespace)
+	teamUuid, err := a.teamUuid(ctx, team)
+	if err != nil {
+		return fmt.Errorf("team %s: %w", team, err)
+	}
+	key := teamUuid + "|" + project.Uuid
+	a.mu.Lock()
+	granted := a.granted[key]
+	a.mu.Unlock()
+	if granted {
+		return nil
+	}
+	if err = a.addMapping(ctx, teamUuid, project.Uuid); err != nil {
+		return fmt.Errorf("grant team %s access to project %s: %w", team, project.Uuid, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.granted) >= maxGranted {
+		a.granted = make(map[string]bool)
+	}
+	a.granted[key] = true
+	return nil
+}
+
+// Forget drops the grants to the project, e.g. once it is deleted
+func (a *Access) Forget(projectUuid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.granted {
+		if strings.HasSuffix(key, "|"+projectUuid) {
+			delete(a.granted, key)
+		}
+	}
+}
+
+// teamUuid returns the uuid of the team, looking it up or creating it once for concurrent grants
+func (a *Access) teamUuid(ctx context.Context, name string) (string, error) {
+	a.mu.Lock()
+	uuid, ok := a.teamUuids[name]
+	a.mu.Unlock()
+	if ok {
+		return uuid, nil
+	}
+
+	// the lookup is shared by the concurrent grants, it must not fail them all if the first one is cancelled
+	lookupCtx := context.WithoutCancel(ctx)
+	v, err, _ := a.lookups.Do(name, func() (any, error) {
+		uuid, err := a.lookupTeam(lookupCtx, name)
+		if err != nil {
+			return "", err
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.teamUuids[name] = uuid
+		return uuid, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (a *Access) lookupTeam(ctx context.Context, name string) (string, error) {
+	teams, err := a.client.GetTeams(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range teams {
+		if t.Name == name {
+			return t.Uuid, nil
+		}
+	}
+	created, err := a.client.CreateTeam(ctx, name, Permissions)
+	if err != nil {
+		return "", err
+	}
+	if created == nil || created.Uuid == "" {
+		return "", fmt.Errorf("team not created")
+	}
+	return created.Uuid, nil
+}
+
+// addMapping adds the project to the portfolio of the team, the client has no call for it
+func (a *Access) addMapping(ctx context.Context, teamUuid, projectUuid string) error {
+	err := a.api.Do(ctx, "add acl mapping", http.MethodPut, "/api/v1/acl/mapping", map[string]string{
+		"team":    teamUuid,
+		"project": projectUuid,
+	}, nil)
+	if errors.Is(err, sbomstore.ErrAlreadyExists) {
+		// the team already has access to the project
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestGrant(t *testing.T) {
+	var mappings atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/api/v1/acl/mapping", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "project1", body["project"])
+		if mappings.Add(1) > 1 {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	c := mockmonitor.NewClient(t)
+	c.On("Headers", mock.Anything).Return(http.Header{"X-Api-Key": []string{"secret"}}, nil)
+	c.On("GetTeams", mock.Anything).Return([]client.Team{{Uuid: "existing", Name: "team-b"}}, nil)
+	c.On("CreateTeam", mock.Anything, "team-a", Permissions).Return(&client.Team{Uuid: "created", Name: "team-a"}, nil).Once()
+
+	a := New(c, server.URL+"/", map[string]string{"other": "team-b"})
+	assert.Equal(t, "team-b", a.Team("other"))
+	assert.Equal(t, "team-a", a.Team("team-a"))
+
+	project := &client.Project{Uuid: "project1"}
+	assert.NoError(t, a.Grant(context.Background(), "team-a", project))
+	// already granted
+	assert.NoError(t, a.Grant(context.Background(), "team-a", project))
+	assert.Equal(t, int32(1), mappings.Load())
+
+	// the mapping exists already in Dependency-Track
+	assert.NoError(t, a.Grant(context.Background(), "other", project))
+	assert.Equal(t, int32(2), mappings.Load())
+	c.AssertNumberOfCalls(t, "GetTeams", 2)
+
+	// grants to deleted projects are forgotten
+	a.Forget("project1")
+	assert.NoError(t, a.Grant(context.Background(), "team-a", project))
+	assert.Equal(t, int32(3), mappings.Load())
+}
+
+func TestConcurrentGrantsCreateTeamOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	c := mockmonitor.NewClient(t)
+	c.On("Headers", mock.Anything).Return(http.Header{}, nil)
+	c.On("GetTeams", mock.Anything).Return([]client.Team{}, nil)
+	c.On("CreateTeam", mock.Anything, "team-a", Permissions).Return(&client.Team{Uuid: "created", Name: "team-a"}, nil).Once()
+
+	a := New(c, server.URL+"/", nil)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, a.Grant(context.Background(), "team-a", &client.Project{Uuid: fmt.Sprintf("project%d", i)}))
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, a.granted, 10)
+}
+
+func TestGrantFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c := mockmonitor.NewClient(t)
+	c.On("Headers", mock.Anything).Return(http.Header{}, nil)
+	c.On("GetTeams", mock.Anything).Return([]client.Team{{Uuid: "existing", Name: "team-a"}}, nil).Once()
+
+	a := New(c, server.URL, nil)
+	assert.ErrorContains(t, a.Grant(context.Background(), "team-a", &client.Project{Uuid: "project1"}), "403")
+}
+
+func TestTeamLookupOutlivesCancelledGrant(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	notCancelled := mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil })
+	c.On("GetTeams", notCancelled).Return([]client.Team{{Uuid: "existing", Name: "team-a"}}, nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := New(c, "", nil)
+	uuid, err := a.teamUuid(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", uuid)
+}
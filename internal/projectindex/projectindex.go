@@ -0,0 +1,306 @@
+package projectindex
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	log "github.com/sirupsen/logrus"
+
+	"slsa-verde/internal/observability"
+	"slsa-verde/internal/sbomstore"
+)
+
+// Index is a Dependency-Track client answering the project lookups of a cluster from memory. It is populated by
+// listing the projects tagged with the environment of the cluster, kept up to date from the writes made through it
+// and refreshed periodically. Lookups of projects not in the index, e.g. of images first used in another cluster,
+// and all lookups until it is populated go to Dependency-Track.
+type Index struct {
+	client.Client
+	cluster string
+	log     *log.Entry
+
+	mu       sync.RWMutex
+	ready    bool
+	projects map[string]*client.Project
+	// uuids of the projects by name and version
+	uuids map[string]string
+	// written are the projects written while the index is refreshed, nil if deleted, they win over the listing
+	written    map[string]*client.Project
+	refreshing bool
+}
+
+func New(c client.Client, cluster string) *Index {
+	return &Index{
+		Client:   sbomstore.New(c),
+		cluster:  cluster,
+		log:      log.WithField("package", "projectindex"),
+		projects: make(map[string]*client.Project),
+		uuids:    make(map[string]string),
+	}
+}
+
+// Run refreshes the index at the interval until the context is done, the first refresh is made right away
+func (i *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := i.Refresh(ctx); err != nil {
+			i.log.Warnf("refresh project index: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the projects of the index with the ones tagged with the environment of the cluster
+func (i *Index) Refresh(ctx context.Context) error {
+	i.mu.Lock()
+	i.refreshing = true
+	i.written = make(map[string]*client.Project)
+	i.mu.Unlock()
+
+	listed, err := i.Client.GetProjectsByTag(ctx, client.EnvironmentTagPrefix.With(i.cluster))
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	written := i.written
+	i.refreshing = false
+	i.written = nil
+	if err != nil {
+		return err
+	}
+
+	projects := make(map[string]*client.Project, len(listed))
+	for _, p := range listed {
+		projects[p.Uuid] = p
+	}
+	for uuid, p := range written {
+		if p == nil {
+			delete(projects, uuid)
+			continue
+		}
+		projects[uuid] = p
+	}
+	i.projects = projects
+	i.uuids = make(map[string]string, len(projects))
+	for uuid, p := range projects {
+		i.uuids[key(p.Name, p.Version)] = uuid
+	}
+	i.ready = true
+	observability.ProjectIndexProjects.Set(float64(len(projects)))
+	i.log.Debugf("project index refreshed with %d projects", len(projects))
+	return nil
+}
+
+func (i *Index) GetProject(ctx context.Context, name, version string) (*client.Project, error) {
+	i.mu.RLock()
+	p := i.projects[i.uuids[key(name, version)]]
+	ready := i.ready
+	i.mu.RUnlock()
+	if p != nil && ready {
+		observability.ProjectIndexRequestsSaved.WithLabelValues("get_project").Inc()
+		return clone(p), nil
+	}
+
+	p, err := i.Client.GetProject(ctx, name, version)
+	if err != nil || p == nil {
+		return p, err
+	}
+	i.set(p)
+	return p, nil
+}
+
+// GetProjectsByTag returns the projects of the index with the tag, the tag is query escaped like for the client
+func (i *Index) GetProjectsByTag(ctx context.Context, tag string) ([]*client.Project, error) {
+	name, err := url.QueryUnescape(tag)
+	if err != nil {
+		name = tag
+	}
+	i.mu.RLock()
+	if !i.ready {
+		i.mu.RUnlock()
+		return i.Client.GetProjectsByTag(ctx, tag)
+	}
+	projects := make([]*client.Project, 0)
+	for _, p := range i.projects {
+		if slices.ContainsFunc(p.Tags, func(t client.Tag) bool { return t.Name == name }) {
+			projects = append(projects, clone(p))
+		}
+	}
+	i.mu.RUnlock()
+	observability.ProjectIndexRequestsSaved.WithLabelValues("get_projects_by_tag").Inc()
+	return projects, nil
+}
+
+func (i *Index) CreateProject(ctx context.Context, name, version, group string, tags []string) (*client.Project, error) {
+	p, err := i.Client.CreateProject(ctx, name, version, group, tags)
+	if err == nil && p != nil {
+		i.set(p)
+	}
+	return p, err
+}
+
+func (i *Index) CreateChildProject(ctx context.Context, project *client.Project, name, version, group, classifier string, tags []string) (*client.Project, error) {
+	p, err := i.Client.CreateChildProject(ctx, project, name, version, group, classifier, tags)
+	if err == nil && p != nil {
+		i.set(p)
+	}
+	return p, err
+}
+
+// UpdateProject updates the project in Dependency-Track. The tags of a project in the index may be older than the
+// ones in Dependency-Track, e.g. after the orphan cronjob removed a workload tag, so the tags of the project are read
+// from Dependency-Track first and only the tags changed by the caller relative to the index are added or removed.
+func (i *Index) UpdateProject(ctx context.Context, uuid, name, version, group string, tags []string) (*client.Project, error) {
+	i.mu.RLock()
+	indexed := i.projects[uuid]
+	i.mu.RUnlock()
+	if indexed != nil {
+		current, err := i.Client.GetProject(ctx, indexed.Name, indexed.Version)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || current.Uuid != uuid {
+			// deleted by someone else, e.g. the orphan cronjob
+			i.remove(uuid)
+			return nil, &sbomstore.Error{Op: "update project", Reason: sbomstore.ErrNotFound, Err: errors.New("project " + uuid + " was deleted")}
+		}
+		tags = mergeTags(tagNames(indexed), tags, tagNames(current))
+	}
+
+	p, err := i.Client.UpdateProject(ctx, uuid, name, version, group, tags)
+	if errors.Is(err, sbomstore.ErrNotFound) {
+		// deleted by someone else, e.g. the orphan cronjob
+		i.remove(uuid)
+	}
+	if err != nil {
+		return p, err
+	}
+	if p != nil {
+		i.set(p)
+		return p, nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	existing, ok := i.projects[uuid]
+	if !ok {
+		return p, nil
+	}
+	updated := clone(existing)
+	updated.Name = name
+	updated.Version = version
+	updated.Group = group
+	updated.Tags = make([]client.Tag, 0, len(tags))
+	for _, t := range tags {
+		updated.Tags = append(updated.Tags, client.Tag{Name: t})
+	}
+	i.setLocked(updated)
+	return p, nil
+}
+
+// mergeTags applies the changes from the indexed tags to the updated tags on the current tags
+func mergeTags(indexed, updated, current []string) []string {
+	merged := make([]string, 0, len(current)+len(updated))
+	for _, t := range current {
+		if slices.Contains(indexed, t) && !slices.Contains(updated, t) {
+			// removed by the caller
+			continue
+		}
+		merged = append(merged, t)
+	}
+	for _, t := range updated {
+		if !slices.Contains(merged, t) && !slices.Contains(indexed, t) {
+			// added by the caller
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+func tagNames(p *client.Project) []string {
+	names := make([]string, 0, len(p.Tags))
+	for _, t := range p.Tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func (i *Index) DeleteProject(ctx context.Context, uuid string) error {
+	err := i.Client.DeleteProject(ctx, uuid)
+	if err != nil && !errors.Is(err, sbomstore.ErrNotFound) {
+		return err
+	}
+	i.remove(uuid)
+	return err
+}
+
+func (i *Index) remove(uuid string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if p, ok := i.projects[uuid]; ok {
+		delete(i.uuids, key(p.Name, p.Version))
+		delete(i.projects, uuid)
+	}
+	if i.refreshing {
+		i.written[uuid] = nil
+	}
+	observability.ProjectIndexProjects.Set(float64(len(i.projects)))
+}
+
+// UploadProject marks the project as having a BOM once it is uploaded, the format is only known to Dependency-Track
+func (i *Index) UploadProject(ctx context.Context, name, version, parentUuid string, autoCreate bool, bom []byte) error {
+	if err := i.Client.UploadProject(ctx, name, version, parentUuid, autoCreate, bom); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if p, ok := i.projects[i.uuids[key(name, version)]]; ok && p.LastBomImportFormat == "" {
+		updated := clone(p)
+		updated.LastBomImportFormat = "CycloneDX"
+		i.setLocked(updated)
+	}
+	return nil
+}
+
+// Unwrap returns the client the index wraps
+func (i *Index) Unwrap() client.Client {
+	return i.Client
+}
+
+func key(name, version string) string {
+	return name + "\n" + version
+}
+
+func (i *Index) set(p *client.Project) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.setLocked(clone(p))
+}
+
+func (i *Index) setLocked(p *client.Project) {
+	if existing, ok := i.projects[p.Uuid]; ok {
+		delete(i.uuids, key(existing.Name, existing.Version))
+	}
+	i.projects[p.Uuid] = p
+	i.uuids[key(p.Name, p.Version)] = p.Uuid
+	if i.refreshing {
+		i.written[p.Uuid] = p
+	}
+	observability.ProjectIndexProjects.Set(float64(len(i.projects)))
+}
+
+// clone copies the project, callers change the tags of the projects they get
+func clone(p *client.Project) *client.Project {
+	c := *p
+	c.Tags = slices.Clone(p.Tags)
+	return &c
+}
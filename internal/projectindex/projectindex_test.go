@@ -0,0 +1,160 @@
+package projectindex
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/observability"
+	"slsa-verde/internal/sbomstore"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+const workloadTag = "workload:test|testns|app|testapp"
+
+func project(uuid, name, version string, tags ...string) *client.Project {
+	p := &client.Project{Uuid: uuid, Name: name, Version: version}
+	for _, t := range tags {
+		p.Tags = append(p.Tags, client.Tag{Name: t})
+	}
+	return p
+}
+
+func TestLookupsBeforeRefreshGoToDependencyTrack(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	i := New(c, "test")
+
+	c.On("GetProject", mock.Anything, "test/nginx", "1.0").Return(nil, nil).Once()
+	c.On("GetProjectsByTag", mock.Anything, url.QueryEscape(workloadTag)).Return([]*client.Project{}, nil).Once()
+
+	p, err := i.GetProject(context.Background(), "test/nginx", "1.0")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+	_, err = i.GetProjectsByTag(context.Background(), url.QueryEscape(workloadTag))
+	assert.NoError(t, err)
+}
+
+func TestLookupsAnsweredFromIndex(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	i := New(c, "test")
+	saved := testutil.ToFloat64(observability.ProjectIndexRequestsSaved.WithLabelValues("get_project"))
+
+	c.On("GetProjectsByTag", mock.Anything, "env:test").Return([]*client.Project{
+		project("v1", "test/nginx", "1.0", workloadTag, "env:test"),
+		project("other", "test/other", "1.0", "workload:test|testns|app|other", "env:test"),
+	}, nil).Once()
+	assert.NoError(t, i.Refresh(context.Background()))
+
+	p, err := i.GetProject(context.Background(), "test/nginx", "1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", p.Uuid)
+	assert.Equal(t, saved+1, testutil.ToFloat64(observability.ProjectIndexRequestsSaved.WithLabelValues("get_project")))
+
+	// the caller changing the project does not change the index
+	p.Tags = append(p.Tags[:0], client.Tag{Name: "changed"})
+	projects, err := i.GetProjectsByTag(context.Background(), url.QueryEscape(workloadTag))
+	assert.NoError(t, err)
+	assert.Len(t, projects, 1)
+
+	// projects not in the index are looked up and added
+	c.On("GetProject", mock.Anything, "test/shared", "1.0").Return(project("shared", "test/shared", "1.0", "env:dev"), nil).Once()
+	_, err = i.GetProject(context.Background(), "test/shared", "1.0")
+	assert.NoError(t, err)
+	_, err = i.GetProject(context.Background(), "test/shared", "1.0")
+	assert.NoError(t, err)
+}
+
+func TestWritesUpdateIndex(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	i := New(c, "test")
+	c.On("GetProjectsByTag", mock.Anything, "env:test").Return([]*client.Project{
+		project("v1", "test/nginx", "1.0", workloadTag, "env:test"),
+	}, nil).Once()
+	assert.NoError(t, i.Refresh(context.Background()))
+
+	c.On("CreateProject", mock.Anything, "test/nginx", "2.0", "test", []string{workloadTag, "env:test"}).
+		Return(project("v2", "test/nginx", "2.0", workloadTag, "env:test"), nil).Once()
+	_, err := i.CreateProject(context.Background(), "test/nginx", "2.0", "test", []string{workloadTag, "env:test"})
+	assert.NoError(t, err)
+
+	c.On("UploadProject", mock.Anything, "test/nginx", "2.0", "v2", false, []byte("{}")).Return(nil).Once()
+	assert.NoError(t, i.UploadProject(context.Background(), "test/nginx", "2.0", "v2", false, []byte("{}")))
+	p, err := i.GetProject(context.Background(), "test/nginx", "2.0")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, p.LastBomImportFormat)
+
+	c.On("GetProject", mock.Anything, "test/nginx", "1.0").Return(project("v1", "test/nginx", "1.0", workloadTag, "env:test"), nil).Once()
+	c.On("UpdateProject", mock.Anything, "v1", "test/nginx", "1.0", "", []string{"env:test"}).Return(nil, nil).Once()
+	_, err = i.UpdateProject(context.Background(), "v1", "test/nginx", "1.0", "", []string{"env:test"})
+	assert.NoError(t, err)
+	projects, err := i.GetProjectsByTag(context.Background(), url.QueryEscape(workloadTag))
+	assert.NoError(t, err)
+	assert.Len(t, projects, 1)
+	assert.Equal(t, "v2", projects[0].Uuid)
+
+	c.On("DeleteProject", mock.Anything, "v2").Return(nil).Once()
+	assert.NoError(t, i.DeleteProject(context.Background(), "v2"))
+	projects, err = i.GetProjectsByTag(context.Background(), url.QueryEscape(workloadTag))
+	assert.NoError(t, err)
+	assert.Empty(t, projects)
+
+	// failed writes leave the index as is
+	c.On("DeleteProject", mock.Anything, "v1").Return(errors.New("status 500")).Once()
+	assert.Error(t, i.DeleteProject(context.Background(), "v1"))
+	p, err = i.GetProject(context.Background(), "test/nginx", "1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", p.Uuid)
+}
+
+func TestUpdateKeepsChangesMadeOutsideIndex(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	i := New(c, "test")
+	otherTag := "workload:test|testns|app|other"
+	c.On("GetProjectsByTag", mock.Anything, "env:test").Return([]*client.Project{
+		project("v1", "test/nginx", "1.0", workloadTag, otherTag, "env:test"),
+		project("v2", "test/nginx", "2.0", workloadTag, "env:test"),
+	}, nil).Once()
+	assert.NoError(t, i.Refresh(context.Background()))
+
+	// the orphan cronjob removed the other workload and someone added a team tag since the refresh
+	c.On("GetProject", mock.Anything, "test/nginx", "1.0").Return(project("v1", "test/nginx", "1.0", workloadTag, "env:test", "team:testns"), nil).Once()
+	// the caller removes the workload tag and adds a superseded tag to the tags it got from the index
+	c.On("UpdateProject", mock.Anything, "v1", "test/nginx", "1.0", "", []string{"env:test", "team:testns", "superseded"}).Return(nil, nil).Once()
+	_, err := i.UpdateProject(context.Background(), "v1", "test/nginx", "1.0", "", []string{otherTag, "env:test", "superseded"})
+	assert.NoError(t, err)
+
+	// projects deleted outside the index are not recreated by updates
+	c.On("GetProject", mock.Anything, "test/nginx", "2.0").Return(nil, nil).Once()
+	_, err = i.UpdateProject(context.Background(), "v2", "test/nginx", "2.0", "", []string{"env:test"})
+	assert.ErrorIs(t, err, sbomstore.ErrNotFound)
+	projects, err := i.GetProjectsByTag(context.Background(), url.QueryEscape(workloadTag))
+	assert.NoError(t, err)
+	assert.Empty(t, projects)
+}
+
+func TestFailedRefreshKeepsIndex(t *testing.T) {
+	c := mockmonitor.NewClient(t)
+	i := New(c, "test")
+	c.On("GetProjectsByTag", mock.Anything, "env:test").Return([]*client.Project{
+		project("v1", "test/nginx", "1.0", workloadTag, "env:test"),
+	}, nil).Once()
+	assert.NoError(t, i.Refresh(context.Background()))
+
+	c.On("GetProjectsByTag", mock.Anything, "env:test").Return(nil, errors.New("status 503")).Once()
+	assert.Error(t, i.Refresh(context.Background()))
+
+	p, err := i.GetProject(context.Background(), "test/nginx", "1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", p.Uuid)
+}
+
+func TestIndexIsNotWrappedAgain(t *testing.T) {
+	i := New(mockmonitor.NewClient(t), "test")
+	assert.Same(t, i, sbomstore.Wrap(i))
+}
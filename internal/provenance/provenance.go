@@ -0,0 +1,173 @@
+package provenance
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+
+	"slsa-verde/internal/attestation"
+	"slsa-verde/internal/sbomstore"
+)
+
+// Group of the project properties slsa-verde records
+const Group = "slsa-verde"
+
+// Types of project properties defined by Dependency-Track
+const (
+	TypeString    = "STRING"
+	TypeTimestamp = "TIMESTAMP"
+	TypeURL       = "URL"
+)
+
+// Names of the project properties describing the provenance of the image of a project
+const (
+	LogIndex                 = "rekor-log-index"
+	IntegratedTime           = "rekor-integrated-time"
+	OIDCIssuer               = "oidc-issuer"
+	BuildTrigger             = "build-trigger"
+	GitHubWorkflowName       = "github-workflow-name"
+	GitHubWorkflowRef        = "github-workflow-ref"
+	GitHubWorkflowSHA        = "github-workflow-sha"
+	RunnerEnvironment        = "runner-environment"
+	SourceRepositoryOwnerURI = "source-repository-owner-uri"
+	BuildConfigURI           = "build-config-uri"
+	RunInvocationURI         = "run-invocation-uri"
+)
+
+type Property struct {
+	GroupName     string `json:"groupName"`
+	PropertyName  string `json:"propertyName"`
+	PropertyValue string `json:"propertyValue"`
+	PropertyType  string `json:"propertyType"`
+	Description   string `json:"description,omitempty"`
+}
+
+// Properties returns the project properties describing the provenance in the Rekor metadata, fields without a
+// value are left out
+func Properties(rekor *attestation.Rekor) []Property {
+	if rekor == nil {
+		return nil
+	}
+	properties := make([]Property, 0, 11)
+	add := func(name, value, typ string) {
+		if value != "" {
+			properties = append(properties, Property{GroupName: Group, PropertyName: name, PropertyValue: value, PropertyType: typ})
+		}
+	}
+	add(LogIndex, rekor.LogIndex, TypeString)
+	add(IntegratedTime, timestamp(rekor.IntegratedTime), TypeTimestamp)
+	add(OIDCIssuer, rekor.OIDCIssuer, TypeURL)
+	add(BuildTrigger, rekor.BuildTrigger, TypeString)
+	add(GitHubWorkflowName, rekor.GitHubWorkflowName, TypeString)
+	add(GitHubWorkflowRef, rekor.GitHubWorkflowRef, TypeString)
+	add(GitHubWorkflowSHA, rekor.GitHubWorkflowSHA, TypeString)
+	add(RunnerEnvironment, rekor.RunnerEnvironment, TypeString)
+	add(SourceRepositoryOwnerURI, rekor.SourceRepositoryOwnerURI, TypeURL)
+	add(BuildConfigURI, rekor.BuildConfigURI, TypeURL)
+	add(RunInvocationURI, rekor.RunInvocationURI, TypeURL)
+	return properties
+}
+
+// Rekor returns the Rekor metadata recorded in the properties, nil if there is none
+func Rekor(properties []Property) *attestation.Rekor {
+	values := make(map[string]string, len(properties))
+	for _, p := range properties {
+		if p.GroupName == Group {
+			values[p.PropertyName] = p.PropertyValue
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &attestation.Rekor{
+		LogIndex:                 values[LogIndex],
+		IntegratedTime:           unix(values[IntegratedTime]),
+		OIDCIssuer:               values[OIDCIssuer],
+		BuildTrigger:             values[BuildTrigger],
+		GitHubWorkflowName:       values[GitHubWorkflowName],
+		GitHubWorkflowRef:        values[GitHubWorkflowRef],
+		GitHubWorkflowSHA:        values[GitHubWorkflowSHA],
+		RunnerEnvironment:        values[RunnerEnvironment],
+		SourceRepositoryOwnerURI: values[SourceRepositoryOwnerURI],
+		BuildConfigURI:           values[BuildConfigURI],
+		RunInvocationURI:         values[RunInvocationURI],
+	}
+}
+
+// timestamp formats the unix time Rekor integrated the entry for a TIMESTAMP property
+func timestamp(integratedTime string) string {
+	sec, err := strconv.ParseInt(integratedTime, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.Unix(sec, 0).UTC().Format(time.RFC3339)
+}
+
+func unix(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// Store records the provenance of the images of projects as project properties, the client has no calls for them
+type Store struct {
+	api *sbomstore.API
+}
+
+func New(c client.Client, url string) *Store {
+	return &Store{api: sbomstore.NewAPI(c, url)}
+}
+
+// Rekor returns the Rekor metadata recorded in the properties of the project, nil if there is none
+func (s *Store) Rekor(ctx context.Context, projectUuid string) (*attestation.Rekor, error) {
+	properties, err := s.properties(ctx, projectUuid)
+	if err != nil {
+		return nil, err
+	}
+	return Rekor(properties), nil
+}
+
+// Record sets the properties of the project to the provenance in the Rekor metadata, creating the missing ones and
+// updating the ones that changed
+func (s *Store) Record(ctx context.Context, projectUuid string, rekor *attestation.Rekor) error {
+	existing, err := s.properties(ctx, projectUuid)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(existing))
+	for _, p := range existing {
+		if p.GroupName == Group {
+			values[p.PropertyName] = p.PropertyValue
+		}
+	}
+
+	path := "/api/v1/project/" + projectUuid + "/property"
+	for _, p := range Properties(rekor) {
+		value, ok := values[p.PropertyName]
+		switch {
+		case !ok:
+			err = s.api.Do(ctx, "create project property", http.MethodPut, path, p, nil)
+		case value != p.PropertyValue:
+			err = s.api.Do(ctx, "update project property", http.MethodPost, path, p, nil)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) properties(ctx context.Context, projectUuid string) ([]Property, error) {
+	var properties []Property
+	if err := s.api.Do(ctx, "get project properties", http.MethodGet, "/api/v1/project/"+projectUuid+"/property", nil, &properties); err != nil {
+		return nil, err
+	}
+	return properties, nil
+}
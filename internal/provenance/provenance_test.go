@@ -0,0 +1,79 @@
+package provenance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/attestation"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+var rekor = &attestation.Rekor{
+	LogIndex:           "1234",
+	IntegratedTime:     "1700000000",
+	OIDCIssuer:         "https://token.actions.githubusercontent.com",
+	GitHubWorkflowName: "build",
+	GitHubWorkflowRef:  "refs/heads/main",
+	BuildConfigURI:     "https://github.com/nais/slsa-verde/.github/workflows/main.yml@refs/heads/main",
+}
+
+func TestProperties(t *testing.T) {
+	properties := Properties(rekor)
+	assert.Len(t, properties, 6)
+	assert.Contains(t, properties, Property{
+		GroupName:     Group,
+		PropertyName:  IntegratedTime,
+		PropertyValue: "2023-11-14T22:13:20Z",
+		PropertyType:  TypeTimestamp,
+	})
+	assert.Contains(t, properties, Property{
+		GroupName:     Group,
+		PropertyName:  BuildConfigURI,
+		PropertyValue: rekor.BuildConfigURI,
+		PropertyType:  TypeURL,
+	})
+	assert.Equal(t, rekor, Rekor(properties))
+	assert.Nil(t, Rekor([]Property{{GroupName: "other", PropertyName: LogIndex, PropertyValue: "1"}}))
+	assert.Nil(t, Properties(nil))
+}
+
+func TestRecord(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/project/uuid1/property", r.URL.Path)
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode([]Property{
+				{GroupName: Group, PropertyName: LogIndex, PropertyValue: "1234", PropertyType: TypeString},
+				{GroupName: Group, PropertyName: GitHubWorkflowRef, PropertyValue: "refs/heads/other", PropertyType: TypeString},
+				{GroupName: "other", PropertyName: "owner", PropertyValue: "someone", PropertyType: TypeString},
+			})
+			return
+		}
+		var p Property
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		mu.Lock()
+		requests[r.Method] = append(requests[r.Method], p.PropertyName)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	c := mockmonitor.NewClient(t)
+	c.On("Headers", mock.Anything).Return(http.Header{}, nil)
+	s := New(c, server.URL)
+
+	assert.NoError(t, s.Record(context.Background(), "uuid1", rekor))
+	assert.ElementsMatch(t, []string{IntegratedTime, OIDCIssuer, GitHubWorkflowName, BuildConfigURI}, requests[http.MethodPut])
+	assert.Equal(t, []string{GitHubWorkflowRef}, requests[http.MethodPost])
+
+	recorded, err := s.Rekor(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/other", recorded.GitHubWorkflowRef)
+}
@@ -0,0 +1,84 @@
+package sbomstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+)
+
+// API calls the endpoints of Dependency-Track the client has no calls for, authenticated with the headers of the
+// client. The calls share the circuit breaker and the metrics of the client.
+type API struct {
+	client *Client
+	url    string
+	http   *http.Client
+}
+
+func NewAPI(c client.Client, url string) *API {
+	return &API{
+		client: New(c),
+		url:    strings.TrimSuffix(url, "/"),
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Do sends in as JSON to the path, decoding the response into out unless it is nil
+func (a *API) Do(ctx context.Context, op, method, path string, in, out any) error {
+	ctx, done, err := a.client.observe(ctx, op)
+	if err != nil {
+		return err
+	}
+	return done(a.do(ctx, method, path, in, out))
+}
+
+// SetProjectActive sets whether the project is active, inactive projects are left out of the portfolio metrics and
+// notifications of Dependency-Track
+func (a *API) SetProjectActive(ctx context.Context, projectUuid string, active bool) error {
+	return a.Do(ctx, "update project", http.MethodPatch, "/api/v1/project/"+projectUuid, map[string]bool{"active": active}, nil)
+}
+
+func (a *API) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, body)
+	if err != nil {
+		return err
+	}
+	headers, err := a.client.Headers(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the status is reported like the client does, for the errors to be classified alike
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,104 @@
+package sbomstore
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"slsa-verde/internal/breaker"
+)
+
+// Reasons a call to the SBOM store can fail, use errors.Is to tell them apart.
+var (
+	ErrAlreadyExists = errors.New("project already exists")
+	ErrNotFound      = errors.New("not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrUnavailable   = errors.New("sbom store unavailable")
+)
+
+var reasons = []error{
+	ErrAlreadyExists,
+	ErrNotFound,
+	ErrUnauthorized,
+	ErrUnavailable,
+}
+
+// the Dependency-Track client only reports the response status in the error message,
+// e.g. "creating request: status 409: err A project with the specified name already exists."
+var statusPattern = regexp.MustCompile(`status (\d{3})`)
+
+type Error struct {
+	Op     string
+	Reason error
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Reason == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Reason, e.Err}
+}
+
+// Reason returns the failure reason of an SBOM store error, or nil if the error is not classified.
+func Reason(err error) error {
+	for _, r := range reasons {
+		if errors.Is(err, r) {
+			return r
+		}
+	}
+	return nil
+}
+
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var storeErr *Error
+	if errors.As(err, &storeErr) {
+		return err
+	}
+
+	return &Error{
+		Op:     op,
+		Reason: classifyError(err),
+		Err:    err,
+	}
+}
+
+func classifyError(err error) error {
+	if errors.Is(err, breaker.ErrOpen) {
+		return ErrUnavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+
+	match := statusPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return nil
+	}
+
+	status, _ := strconv.Atoi(match[1])
+	switch {
+	case status == http.StatusConflict:
+		return ErrAlreadyExists
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusTooManyRequests, status >= http.StatusInternalServerError:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package sbomstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		err  error
+		want error
+	}{
+		{
+			desc: "project already exists",
+			err:  errors.New("creating request: status 409: err A project with the specified name already exists."),
+			want: ErrAlreadyExists,
+		},
+		{
+			desc: "project not found",
+			err:  errors.New("status 404: project not found"),
+			want: ErrNotFound,
+		},
+		{
+			desc: "wrong credentials",
+			err:  errors.New("status 401: unauthorized"),
+			want: ErrUnauthorized,
+		},
+		{
+			desc: "server error",
+			err:  errors.New("status 503: service unavailable"),
+			want: ErrUnavailable,
+		},
+		{
+			desc: "unknown error is not classified",
+			err:  errors.New("something else"),
+			want: nil,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := wrapError("create project", tc.err)
+			assert.Equal(t, tc.want, Reason(err))
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	t.Run("nil error stays nil", func(t *testing.T) {
+		assert.NoError(t, wrapError("create project", nil))
+	})
+}
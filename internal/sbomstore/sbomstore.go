@@ -0,0 +1,199 @@
+package sbomstore
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"slsa-verde/internal/breaker"
+	"slsa-verde/internal/observability"
+)
+
+var _ client.Client = &Client{}
+
+// Client wraps a Dependency-Track client, returning errors of type *Error from the calls slsa-verde makes.
+// The calls fail fast with ErrUnavailable while the circuit breaker of Dependency-Track is open.
+type Client struct {
+	client.Client
+	breaker *breaker.Breaker
+}
+
+func New(c client.Client) *Client {
+	if wrapped, ok := c.(*Client); ok {
+		return wrapped
+	}
+	return &Client{Client: c, breaker: breaker.Default.Get("dependencytrack")}
+}
+
+// Wrap wraps c like New unless it is a client already wrapping a *Client, e.g. the project index, it is then returned as is
+func Wrap(c client.Client) client.Client {
+	if u, ok := c.(interface{ Unwrap() client.Client }); ok {
+		if _, ok := u.Unwrap().(*Client); ok {
+			return c
+		}
+	}
+	return New(c)
+}
+
+func (c *Client) GetProject(ctx context.Context, name, version string) (*client.Project, error) {
+	ctx, done, err := c.observe(ctx, "get project")
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Client.GetProject(ctx, name, version)
+	return p, done(err)
+}
+
+func (c *Client) GetProjectsByTag(ctx context.Context, tag string) ([]*client.Project, error) {
+	ctx, done, err := c.observe(ctx, "get projects by tag")
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Client.GetProjectsByTag(ctx, tag)
+	return p, done(err)
+}
+
+func (c *Client) CreateProject(ctx context.Context, name, version, group string, tags []string) (*client.Project, error) {
+	ctx, done, err := c.observe(ctx, "create project")
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Client.CreateProject(ctx, name, version, group, tags)
+	return p, done(err)
+}
+
+func (c *Client) CreateChildProject(ctx context.Context, project *client.Project, name, version, group, classifier string, tags []string) (*client.Project, error) {
+	ctx, done, err := c.observe(ctx, "create child project")
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Client.CreateChildProject(ctx, project, name, version, group, classifier, tags)
+	return p, done(err)
+}
+
+func (c *Client) UpdateProject(ctx context.Context, uuid, name, version, group string, tags []string) (*client.Project, error) {
+	ctx, done, err := c.observe(ctx, "update project")
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Client.UpdateProject(ctx, uuid, name, version, group, tags)
+	return p, done(err)
+}
+
+func (c *Client) DeleteProject(ctx context.Context, uuid string) error {
+	ctx, done, err := c.observe(ctx, "delete project")
+	if err != nil {
+		return err
+	}
+	err = c.Client.DeleteProject(ctx, uuid)
+	return done(err)
+}
+
+func (c *Client) UploadProject(ctx context.Context, name, version, parentUuid string, autoCreate bool, bom []byte) error {
+	ctx, done, err := c.observe(ctx, "upload project")
+	if err != nil {
+		return err
+	}
+	err = c.Client.UploadProject(ctx, name, version, parentUuid, autoCreate, bom)
+	return done(err)
+}
+
+func (c *Client) TriggerAnalysis(ctx context.Context, projectUuid string) error {
+	ctx, done, err := c.observe(ctx, "trigger analysis")
+	if err != nil {
+		return err
+	}
+	err = c.Client.TriggerAnalysis(ctx, projectUuid)
+	return done(err)
+}
+
+func (c *Client) GetFindings(ctx context.Context, projectUuid string, suppressed bool) ([]*client.Finding, error) {
+	ctx, done, err := c.observe(ctx, "get findings")
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.Client.GetFindings(ctx, projectUuid, suppressed)
+	return f, done(err)
+}
+
+func (c *Client) GetAnalysisTrail(ctx context.Context, projectUuid, componentUuid, vulnerabilityUuid string) (*client.Analysis, error) {
+	ctx, done, err := c.observe(ctx, "get analysis trail")
+	if err != nil {
+		return nil, err
+	}
+	a, err := c.Client.GetAnalysisTrail(ctx, projectUuid, componentUuid, vulnerabilityUuid)
+	return a, done(err)
+}
+
+func (c *Client) RecordAnalysis(ctx context.Context, analysis *client.AnalysisRequest) error {
+	ctx, done, err := c.observe(ctx, "record analysis")
+	if err != nil {
+		return err
+	}
+	err = c.Client.RecordAnalysis(ctx, analysis)
+	return done(err)
+}
+
+func (c *Client) GetCurrentProjectMetric(ctx context.Context, projectUuid string) (*client.ProjectMetric, error) {
+	ctx, done, err := c.observe(ctx, "get current project metric")
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.Client.GetCurrentProjectMetric(ctx, projectUuid)
+	return m, done(err)
+}
+
+func (c *Client) Version(ctx context.Context) (string, error) {
+	ctx, done, err := c.observe(ctx, "get version")
+	if err != nil {
+		return "", err
+	}
+	v, err := c.Client.Version(ctx)
+	return v, done(err)
+}
+
+// observe starts a span for a call, the returned function ends it, records the duration
+// and outcome of the call and wraps its error. It returns an error instead if the circuit breaker is open.
+func (c *Client) observe(ctx context.Context, op string) (context.Context, func(error) error, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return ctx, nil, wrapError(op, err)
+	}
+	ctx, span := observability.Tracer().Start(ctx, "dependencytrack "+op, trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	return ctx, func(err error) error {
+		err = wrapError(op, err)
+		c.breaker.Done(Reason(err) == ErrUnavailable)
+		o := outcome(err)
+		observability.SbomStoreRequestDuration.WithLabelValues(strings.ReplaceAll(op, " ", "_"), o).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("outcome", o))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		return err
+	}, nil
+}
+
+func outcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	switch Reason(err) {
+	case ErrAlreadyExists:
+		return "already_exists"
+	case ErrNotFound:
+		return "not_found"
+	case ErrUnauthorized:
+		return "unauthorized"
+	case ErrUnavailable:
+		return "unavailable"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,43 @@
+package sbomstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nais/dependencytrack/pkg/client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"slsa-verde/internal/observability"
+	mockmonitor "slsa-verde/mocks/internal_/monitor"
+)
+
+func TestClient(t *testing.T) {
+	observability.SbomStoreRequestDuration.Reset()
+	c := mockmonitor.NewClient(t)
+	s := New(c)
+
+	t.Run("should wrap errors from the dependency-track client", func(t *testing.T) {
+		c.On("CreateProject", mock.Anything, "test/nginx", "latest", "test", []string{"team:test"}).
+			Return(nil, errors.New("creating request: status 409: err A project with the specified name already exists.")).Once()
+
+		_, err := s.CreateProject(context.Background(), "test/nginx", "latest", "test", []string{"team:test"})
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		assert.Equal(t, 1, testutil.CollectAndCount(observability.SbomStoreRequestDuration))
+	})
+
+	t.Run("should pass through results", func(t *testing.T) {
+		c.On("GetProject", mock.Anything, "test/nginx", "latest").Return(&client.Project{Uuid: "uuid1"}, nil).Once()
+
+		p, err := s.GetProject(context.Background(), "test/nginx", "latest")
+		assert.NoError(t, err)
+		assert.Equal(t, "uuid1", p.Uuid)
+		assert.Equal(t, 2, testutil.CollectAndCount(observability.SbomStoreRequestDuration))
+	})
+
+	t.Run("should not wrap twice", func(t *testing.T) {
+		assert.Same(t, s, New(s))
+	})
+}
@@ -0,0 +1,136 @@
+package state
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"slsa-verde/internal/attestation"
+)
+
+// Container is the last verification result of a workload container.
+type Container struct {
+	Name          string             `json:"name"`
+	Image         string             `json:"image"`
+	Status        attestation.Status `json:"status"`
+	Digest        string             `json:"digest,omitempty"`
+	PredicateType string             `json:"predicateType,omitempty"`
+	Rekor         *attestation.Rekor `json:"rekor,omitempty"`
+	ProjectUuid   string             `json:"projectUuid,omitempty"`
+	Critical      int                `json:"critical,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	VerifiedAt    time.Time          `json:"verifiedAt"`
+}
+
+type Workload struct {
+	Name       string      `json:"name"`
+	Namespace  string      `json:"namespace"`
+	Type       string      `json:"type"`
+	Containers []Container `json:"containers"`
+}
+
+// Store keeps the verification state of the workloads seen by the monitor in memory.
+type Store struct {
+	mu        sync.RWMutex
+	workloads map[string]*Workload
+}
+
+func NewStore() *Store {
+	return &Store{
+		workloads: make(map[string]*Workload),
+	}
+}
+
+// key identifies a workload by its type as well, workloads of different types may share a name in a namespace
+func key(namespace, workloadType, name string) string {
+	return namespace + "/" + workloadType + "/" + name
+}
+
+// SetContainer records the verification result of a container, replacing the previous result of the container
+func (s *Store) SetContainer(namespace, name, workloadType string, container Container) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.workloads[key(namespace, workloadType, name)]
+	if !ok {
+		w = &Workload{
+			Name:      name,
+			Namespace: namespace,
+			Type:      workloadType,
+		}
+		s.workloads[key(namespace, workloadType, name)] = w
+	}
+
+	i := slices.IndexFunc(w.Containers, func(c Container) bool { return c.Name == container.Name })
+	if i == -1 {
+		w.Containers = append(w.Containers, container)
+		slices.SortFunc(w.Containers, func(a, b Container) int { return strings.Compare(a.Name, b.Name) })
+		return
+	}
+	w.Containers[i] = container
+}
+
+func (s *Store) Delete(namespace, workloadType, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.workloads, key(namespace, workloadType, name))
+}
+
+// Get returns a copy of the workload, safe to use after the store is updated
+func (s *Store) Get(namespace, workloadType, name string) (Workload, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.workloads[key(namespace, workloadType, name)]
+	if !ok {
+		return Workload{}, false
+	}
+	return w.copy(), true
+}
+
+// List returns copies of the workloads sorted by namespace, type and name, filtered by namespace if it is not empty
+func (s *Store) List(namespace string) []Workload {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workloads := make([]Workload, 0, len(s.workloads))
+	for _, w := range s.workloads {
+		if namespace != "" && w.Namespace != namespace {
+			continue
+		}
+		workloads = append(workloads, w.copy())
+	}
+	slices.SortFunc(workloads, func(a, b Workload) int {
+		return strings.Compare(key(a.Namespace, a.Type, a.Name), key(b.Namespace, b.Type, b.Name))
+	})
+	return workloads
+}
+
+// Container returns the last result of the container with the given name
+func (w Workload) Container(name string) (Container, bool) {
+	for _, c := range w.Containers {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Container{}, false
+}
+
+// SameResult reports whether other has the same outcome for the same digest, or the same image if the digest is unknown
+func (c Container) SameResult(other Container) bool {
+	return c.Status == other.Status && c.artifact() == other.artifact()
+}
+
+func (c Container) artifact() string {
+	if c.Digest != "" {
+		return c.Digest
+	}
+	return c.Image
+}
+
+func (w *Workload) copy() Workload {
+	c := *w
+	c.Containers = slices.Clone(w.Containers)
+	return c
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"slsa-verde/internal/attestation"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	s.SetContainer("ns1", "app1", "app", Container{Name: "sidecar", Status: attestation.StatusUnsigned})
+	s.SetContainer("ns1", "app1", "app", Container{Name: "app1", Status: attestation.StatusRegistryError})
+	s.SetContainer("ns1", "app1", "app", Container{Name: "app1", Status: attestation.StatusVerified, Digest: "123"})
+	s.SetContainer("ns2", "job1", "job", Container{Name: "job1", Status: attestation.StatusVerified})
+
+	t.Run("should replace the result of a container", func(t *testing.T) {
+		w, ok := s.Get("ns1", "app", "app1")
+		assert.True(t, ok)
+		assert.Equal(t, "app", w.Type)
+		assert.Equal(t, []Container{
+			{Name: "app1", Status: attestation.StatusVerified, Digest: "123"},
+			{Name: "sidecar", Status: attestation.StatusUnsigned},
+		}, w.Containers)
+	})
+
+	t.Run("should list workloads by namespace", func(t *testing.T) {
+		assert.Len(t, s.List(""), 2)
+		workloads := s.List("ns2")
+		assert.Len(t, workloads, 1)
+		assert.Equal(t, "job1", workloads[0].Name)
+	})
+
+	t.Run("should return copies", func(t *testing.T) {
+		w, _ := s.Get("ns1", "app", "app1")
+		w.Containers[0].Status = attestation.StatusUnsigned
+		w, _ = s.Get("ns1", "app", "app1")
+		assert.Equal(t, attestation.StatusVerified, w.Containers[0].Status)
+	})
+
+	t.Run("should keep workloads of different types apart", func(t *testing.T) {
+		s.SetContainer("ns2", "job1", "app", Container{Name: "job1", Status: attestation.StatusUnsigned})
+		w, ok := s.Get("ns2", "job", "job1")
+		assert.True(t, ok)
+		assert.Equal(t, attestation.StatusVerified, w.Containers[0].Status)
+		w, ok = s.Get("ns2", "app", "job1")
+		assert.True(t, ok)
+		assert.Equal(t, attestation.StatusUnsigned, w.Containers[0].Status)
+
+		s.Delete("ns2", "app", "job1")
+		_, ok = s.Get("ns2", "job", "job1")
+		assert.True(t, ok)
+	})
+
+	t.Run("should delete workload", func(t *testing.T) {
+		s.Delete("ns1", "app", "app1")
+		_, ok := s.Get("ns1", "app", "app1")
+		assert.False(t, ok)
+	})
+}
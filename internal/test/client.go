@@ -1,7 +1,12 @@
 package test
 
 import (
+	"context"
 	"net/http"
+
+	"github.com/nais/v13s/pkg/api/vulnerabilities"
+	"github.com/nais/v13s/pkg/api/vulnerabilities/management"
+	"google.golang.org/grpc"
 )
 
 // RoundTripFunc .
@@ -18,3 +23,15 @@ func NewTestClient(fn RoundTripFunc) *http.Client {
 		Transport: RoundTripFunc(fn),
 	}
 }
+
+// VulnerabilitiesClient records the workloads registered in v13s
+type VulnerabilitiesClient struct {
+	vulnerabilities.Client
+	Registered []*management.RegisterWorkloadRequest
+}
+
+// RegisterWorkload .
+func (f *VulnerabilitiesClient) RegisterWorkload(_ context.Context, in *management.RegisterWorkloadRequest, _ ...grpc.CallOption) (*management.RegisterWorkloadResponse, error) {
+	f.Registered = append(f.Registered, in)
+	return &management.RegisterWorkloadResponse{}, nil
+}
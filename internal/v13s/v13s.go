@@ -0,0 +1,42 @@
+package v13s
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/nais/v13s/pkg/api/auth"
+	"github.com/nais/v13s/pkg/api/vulnerabilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// NewClient returns a client of the vulnerabilities API (v13s) at url, authenticated with a Google ID token
+// of the service account
+func NewClient(ctx context.Context, url, serviceAccountEmail string) (vulnerabilities.Client, error) {
+	dialOptions := make([]grpc.DialOption, 0)
+	if strings.Contains(url, "localhost") {
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		tlsOpts := &tls.Config{}
+		transportCreds := credentials.NewTLS(tlsOpts)
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(transportCreds))
+	}
+
+	creds, err := auth.PerRPCGoogleIDToken(ctx, serviceAccountEmail, "v13s")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get per rpc google id token: %w", err)
+	}
+	dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(creds))
+
+	c, err := vulnerabilities.NewClient(
+		url,
+		dialOptions...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vulnerabilities client: %w", err)
+	}
+	return c, err
+}